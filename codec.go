@@ -0,0 +1,156 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// ErrLimitExceeded is returned when decoding would exceed one of the Limits.
+var ErrLimitExceeded = errors.New("Limit exceeded")
+
+// NilPolicy defines how nil pointers are marshaled.
+type NilPolicy int
+
+const (
+	// NilZero marshals a nil pointer as the zero value of its element type.
+	NilZero NilPolicy = iota
+	// NilError refuses to marshal a nil pointer, naming the field in the error.
+	NilError
+	// NilOmit treats a nil pointer as an absent field and writes nothing for it.
+	// Only trailing fields of a struct may be absent, a nil element of an array, slice or map is an error.
+	NilOmit
+)
+
+// DefaultPolicy defines how fields with a default tag are marshaled.
+type DefaultPolicy int
+
+const (
+	// DefaultIgnore marshals the zero value of a field as is.
+	DefaultIgnore DefaultPolicy = iota
+	// DefaultOnZero marshals the default value of a field in place of its zero value.
+	// A non-nil pointer to a zero value is not zero, so it marshals the zero value.
+	DefaultOnZero
+)
+
+// Limits bounds the resources used to decode untrusted input, a zero limit means unlimited.
+type Limits struct {
+	// MaxBytes is the maximum number of bytes read from the input.
+	MaxBytes int
+	// MaxAlloc is the maximum number of bytes allocated for variable-length values.
+	MaxAlloc int
+	// MaxDepth is the maximum nesting depth of decoded values.
+	MaxDepth int
+	// MaxElements is the maximum number of decoded map and slice elements.
+	MaxElements int
+}
+
+// Codec holds the options used to encode and decode binary data.
+// The top-level functions such as MarshalBigEndian are wrappers of a Codec with the matching Order.
+//
+// The zero value of Codec is a big-endian codec without limits which marshals nil pointers as zero values.
+type Codec struct {
+	// Order is the byte order of the binary data, binary.BigEndian if nil.
+	Order binary.ByteOrder
+	// TagName is the key of the struct field tags, the TagName constant if empty.
+	TagName string
+	// NilPolicy defines how nil pointers are marshaled.
+	NilPolicy NilPolicy
+	// DefaultPolicy defines how fields with a default tag are marshaled.
+	DefaultPolicy DefaultPolicy
+	// Version selects the fields of a protocol version by their since and until tags,
+	// zero selects every field. A version field of a struct overrides it for the rest of the struct.
+	Version int
+	// Limits bounds the resources used to unmarshal.
+	Limits
+	// Registry holds the functions of the types registered for this codec,
+	// it is consulted before the default registry.
+	Registry *Registry
+}
+
+// Marshal returns the encoding binary data of ins.
+func (codec *Codec) Marshal(ins interface{}) ([]byte, error) {
+	var buffer = new(bytes.Buffer)
+	if err := marshal(buffer, ins, codec); err != nil {
+		return []byte{}, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// MarshalTo writes the encoding binary data of ins into writer.
+func (codec *Codec) MarshalTo(writer io.Writer, ins interface{}) error {
+	return marshal(writer, ins, codec)
+}
+
+// Append appends the encoding binary data of ins to dst and returns the extended slice.
+// If an error occurs, Append returns dst unchanged.
+func (codec *Codec) Append(dst []byte, ins interface{}) ([]byte, error) {
+	var buffer = bytes.NewBuffer(dst)
+	if err := marshal(buffer, ins, codec); err != nil {
+		return dst, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Size returns the length of the encoding binary data of ins.
+func (codec *Codec) Size(ins interface{}) (int, error) {
+	var counter = new(countWriter)
+	if err := marshal(counter, ins, codec); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// Unmarshal parses the binary data and stores the result in the value pointed to by ins.
+// If ins is nil or not a pointer, Unmarshal returns an error.
+func (codec *Codec) Unmarshal(input []byte, ins interface{}) error {
+	return unmarshal(bytes.NewBuffer(input), ins, codec)
+}
+
+// UnmarshalFrom reads and parses binary data from reader and stores the result in the value pointed to by ins.
+// If ins is nil or not a pointer, UnmarshalFrom returns an error.
+func (codec *Codec) UnmarshalFrom(reader io.Reader, ins interface{}) error {
+	return unmarshal(reader, ins, codec)
+}
+
+func (codec *Codec) order() binary.ByteOrder {
+	if codec.Order == nil {
+		return binary.BigEndian
+	}
+	return codec.Order
+}
+
+// lookup returns the registered functions of tpe,
+// each direction falls back to the default registry when the Registry of codec leaves it nil.
+func (codec *Codec) lookup(tpe reflect.Type) registered {
+	entry := defaultRegistry.lookup(tpe)
+	if codec.Registry != nil {
+		own := codec.Registry.lookup(tpe)
+		if own.encode != nil {
+			entry.encode = own.encode
+		}
+		if own.decode != nil {
+			entry.decode = own.decode
+		}
+	}
+	return entry
+}
+
+func (codec *Codec) tagName() string {
+	if codec.TagName == "" {
+		return TagName
+	}
+	return codec.TagName
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int
+}
+
+func (counter *countWriter) Write(p []byte) (int, error) {
+	counter.n += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,241 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCodecMarshal(t *testing.T) {
+	var (
+		ins    = struct{ A, B uint16 }{1, 2}
+		buffer = new(bytes.Buffer)
+	)
+	for i, caze := range []struct {
+		codec  Codec
+		except []byte
+	}{
+		{Codec{}, []byte{0, 1, 0, 2}},
+		{Codec{Order: binary.BigEndian}, []byte{0, 1, 0, 2}},
+		{Codec{Order: binary.LittleEndian}, []byte{1, 0, 2, 0}},
+	} {
+		if bs, e := caze.codec.Marshal(ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+		buffer.Reset()
+		if e := caze.codec.MarshalTo(buffer, ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(buffer.Bytes(), caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, buffer.Bytes())
+		}
+	}
+}
+
+func TestCodecNilPolicy(t *testing.T) {
+	type addr struct {
+		IP   [4]byte
+		Port uint16
+	}
+	type request struct {
+		Ver    byte
+		Target *addr
+		Ext    *okMarshaler
+	}
+	for i, caze := range []struct {
+		policy NilPolicy
+		ins    interface{}
+		except []byte
+		err    bool
+	}{
+		{NilZero, request{Ver: 5}, []byte{5, 0, 0, 0, 0, 0, 0, 'o', 'k'}, false},
+		{NilError, request{Ver: 5, Target: &addr{}, Ext: &okMarshaler{}}, []byte{5, 0, 0, 0, 0, 0, 0, 'o', 'k'}, false},
+		{NilError, request{Ver: 5, Ext: &okMarshaler{}}, nil, true},
+		{NilError, request{Ver: 5, Target: &addr{}}, nil, true},
+		{NilError, (*addr)(nil), nil, true},
+		{NilOmit, request{Ver: 5}, []byte{5}, false},
+		{NilOmit, request{Ver: 5, Target: &addr{Port: 1}}, []byte{5, 0, 0, 0, 0, 0, 1}, false},
+		{NilOmit, request{Ver: 5, Ext: &okMarshaler{}}, nil, true},
+		{NilOmit, (*addr)(nil), []byte{}, false},
+		{NilOmit, struct {
+			L [3]*byte
+			X byte
+		}{[3]*byte{new(byte), nil, new(byte)}, 9}, nil, true},
+		{NilOmit, []*addr{nil}, nil, true},
+	} {
+		codec := Codec{NilPolicy: caze.policy}
+		if bs, e := codec.Marshal(caze.ins); !caze.err && e != nil {
+			t.Errorf("case %d unexcepted error %v", i, e)
+		} else if caze.err && e == nil {
+			t.Errorf("case %d excepted some error but got nil", i)
+		} else if !caze.err && !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+}
+
+func TestCodecUnmarshal(t *testing.T) {
+	type inTest struct{ A, B uint16 }
+	for i, caze := range []struct {
+		codec Codec
+		data  []byte
+	}{
+		{Codec{}, []byte{0, 1, 0, 2}},
+		{Codec{Order: binary.LittleEndian}, []byte{1, 0, 2, 0}},
+	} {
+		var ins inTest
+		if e := caze.codec.Unmarshal(caze.data, &ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !reflect.DeepEqual(ins, inTest{1, 2}) {
+			t.Errorf("case %d except %v but got %v", i, inTest{1, 2}, ins)
+		}
+		ins = inTest{}
+		if e := caze.codec.UnmarshalFrom(bytes.NewReader(caze.data), &ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !reflect.DeepEqual(ins, inTest{1, 2}) {
+			t.Errorf("case %d except %v but got %v", i, inTest{1, 2}, ins)
+		}
+	}
+}
+
+func TestCodecLimits(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	type inTest struct {
+		Ver   byte
+		Attrs map[byte]byte `bin:"count=8"`
+		Extra string        `bin:"rest"`
+	}
+	var data = []byte{5, 2, 1, 1, 2, 2, 'e', 'x', 't', 'r', 'a'}
+	for i, caze := range []struct {
+		limits Limits
+		ins    interface{}
+		data   []byte
+		err    bool
+	}{
+		{Limits{MaxBytes: 11, MaxAlloc: 9, MaxDepth: 3, MaxElements: 2}, new(inTest), data, false},
+		{Limits{MaxBytes: 10}, new(inTest), data, true},
+		{Limits{MaxBytes: 1}, new(inTest), data, true},
+		{Limits{MaxAlloc: 8}, new(inTest), data, true},
+		{Limits{MaxAlloc: 3}, new(inTest), data, true},
+		{Limits{MaxElements: 1}, new(inTest), data, true},
+		{Limits{MaxDepth: 2}, new(inTest), data, true},
+		{Limits{MaxDepth: 16}, new(node), []byte{}, true},
+		{Limits{MaxAlloc: 2}, new(Bytes8), []byte{2, 'a', 'b'}, false},
+		{Limits{MaxAlloc: 1}, new(Bytes8), []byte{2, 'a', 'b'}, true},
+		{Limits{MaxBytes: 2}, new(Bytes8), []byte{2, 'a', 'b'}, true},
+		{Limits{MaxElements: 1 << 20}, new(map[uint64]uint64), []byte{255, 255, 255, 255}, true},
+		{Limits{MaxAlloc: 1 << 20}, new(map[uint64]uint64), []byte{0, 255, 255, 255}, true},
+	} {
+		codec := Codec{Limits: caze.limits}
+		if e := codec.Unmarshal(caze.data, caze.ins); !caze.err && e != nil {
+			t.Errorf("case %d unexcepted error %v", i, e)
+		} else if caze.err && !errors.Is(e, ErrLimitExceeded) {
+			t.Errorf("case %d excepted ErrLimitExceeded but got %v", i, e)
+		}
+	}
+}
+
+func TestCodecTagName(t *testing.T) {
+	type inTest struct {
+		A byte   `wire:"1" bin:"0"`
+		B uint16 `wire:"0" bin:"-"`
+		C string `wire:"len=2"`
+	}
+	var (
+		codec  = Codec{TagName: "wire"}
+		ins    = inTest{1, 2, "ok"}
+		except = []byte{0, 2, 1, 'o', 'k'}
+		outs   inTest
+	)
+	if bs, e := codec.Marshal(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if e := codec.Unmarshal(except, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if outs != ins {
+		t.Errorf("except %v, but got %v", ins, outs)
+	}
+	if _, e := MarshalBigEndian(ins); e == nil {
+		t.Errorf("except error but got nil")
+	}
+}
+
+func TestCodecAppendSize(t *testing.T) {
+	var (
+		codec = Codec{Order: binary.LittleEndian}
+		ins   = struct {
+			A uint16
+			B Bytes8
+		}{1, Bytes8("ab")}
+		except = []byte{9, 1, 0, 2, 'a', 'b'}
+	)
+	if bs, e := codec.Append([]byte{9}, ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if size, e := codec.Size(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if size != len(except)-1 {
+		t.Errorf("except %d but got %d", len(except)-1, size)
+	}
+
+	dst := []byte{9}
+	if bs, e := codec.Append(dst, struct{ A int }{}); e == nil {
+		t.Errorf("except error but got nil")
+	} else if !bytes.Equal(bs, dst) {
+		t.Errorf("except %v but got %v", dst, bs)
+	}
+	if size, e := codec.Size(struct{ A int }{}); e == nil || size != 0 {
+		t.Errorf("except error but got %d, %v", size, e)
+	}
+}
+
+func TestCodecDefaultPolicy(t *testing.T) {
+	type inTest struct {
+		Ver  byte    `bin:"default=5"`
+		TTL  int8    `bin:"default=-1"`
+		Rate float32 `bin:"default=0.5"`
+		Ack  *bool   `bin:"default=true"`
+	}
+	for i, caze := range []struct {
+		policy DefaultPolicy
+		ins    inTest
+		except []byte
+	}{
+		{DefaultIgnore, inTest{}, []byte{0, 0, 0, 0, 0, 0, 0}},
+		{DefaultOnZero, inTest{}, []byte{5, 0xff, 0x3f, 0, 0, 0, 1}},
+		{DefaultOnZero, inTest{Ver: 4, TTL: 1, Ack: new(bool)}, []byte{4, 1, 0x3f, 0, 0, 0, 0}},
+	} {
+		codec := Codec{DefaultPolicy: caze.policy}
+		if bs, e := codec.Marshal(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+
+	type versionedDefault struct {
+		Ver  uint8 `bin:"version,default=1"`
+		New  uint8 `bin:"since=2"`
+		Port uint8
+	}
+	var (
+		codec = Codec{DefaultPolicy: DefaultOnZero}
+		outs  versionedDefault
+	)
+	if bs, e := codec.Marshal(versionedDefault{New: 9, Port: 7}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{1, 7}) {
+		t.Errorf("except %v but got %v", []byte{1, 7}, bs)
+	} else if e = codec.Unmarshal(bs, &outs); e != nil || outs != (versionedDefault{1, 0, 7}) {
+		t.Errorf("except %v, but got %v %v", versionedDefault{1, 0, 7}, outs, e)
+	}
+}
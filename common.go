@@ -2,108 +2,907 @@ package bin
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 const (
 	// TagName defines the especial tag name in struct field we are using
 	TagName        string = "bin"
 	defaultBufSize        = 4096
+	defaultCount          = 32
 )
 
-func getIndexFromTag(tag string, i int) (int, error) {
-	switch tag {
-	case "":
-		return i, nil
-	case "-":
-		return -1, nil
-	default:
-		if i64, e := strconv.ParseUint(tag, 10, strconv.IntSize); e != nil {
-			return -1, e
-		} else {
-			return int(i64), e
+// field describes one encoded field of a struct.
+type field struct {
+	index  int
+	name   string
+	count  int
+	length int
+	prefix int
+	rest   bool
+	min    int
+	max    int
+	auto   bool
+	magics []magic
+	def    string
+	since  int
+	until  int
+	// version marks the field holding the protocol version of the rest of its struct.
+	version bool
+	// present names the bitmap field whose bit tells whether the field is present.
+	present string
+	bit     int
+	bitmap  int
+	// bits lists the fields whose presence the bitmap field holds.
+	bits []presence
+	// window names the length field bounding the bytes of the field.
+	window      string
+	windowIndex int
+	// windowed is the position plus one of the field bounded by this length field.
+	windowed int
+	// skip is the number of padding bytes before the field, marshaled as pad.
+	skip int
+	pad  byte
+	// blank marks a blank field, which only holds padding.
+	blank bool
+	// raw names the Raw field holding the original bytes of the field.
+	raw      string
+	rawIndex int
+	// term marks a slice ending with a terminator element, which is termValue if valid,
+	// otherwise an element whose IsTerminator method returns true.
+	term      bool
+	termText  string
+	peek      bool
+	termValue reflect.Value
+	// defValue is the parsed def of the type of the field, pointers dereferenced.
+	defValue reflect.Value
+}
+
+// magic is a value of a field which selects the byte order of the rest of its struct.
+// The value is the bytes of the field as they appear in the data, read as a big-endian integer.
+type magic struct {
+	value uint64
+	order binary.ByteOrder
+}
+
+// presence binds a pointer field to a bit of a bitmap field.
+type presence struct {
+	index int
+	bit   int
+}
+
+// rootField describes the top-level value, which spans the whole input.
+var rootField = field{rest: true}
+
+func parseTag(tag string, i int) (idx int, f field, err error) {
+	var inMagic bool
+	idx = i
+	for n, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(option, "=")
+		switch {
+		case n == 0 && key == "":
+			continue
+		case n == 0 && key == "-":
+			return -1, f, nil
+		case n == 0 && key[0] >= '0' && key[0] <= '9':
+			var u64 uint64
+			if u64, err = strconv.ParseUint(key, 10, strconv.IntSize); err != nil {
+				return -1, f, err
+			}
+			idx = int(u64)
+		case key == "len":
+			if f.length, err = strconv.Atoi(value); err != nil || f.length <= 0 {
+				return -1, f, fmt.Errorf("Invalid length '%s'", value)
+			}
+		case option == "rest":
+			f.rest = true
+		case key == "min":
+			if f.min, err = strconv.Atoi(value); err != nil || f.min <= 0 {
+				return -1, f, fmt.Errorf("Invalid min '%s'", value)
+			}
+		case key == "max":
+			if f.max, err = strconv.Atoi(value); err != nil || f.max <= 0 {
+				return -1, f, fmt.Errorf("Invalid max '%s'", value)
+			}
+		case key == "prefix":
+			if f.prefix, err = strconv.Atoi(value); err != nil || !validWidth(f.prefix) {
+				return -1, f, fmt.Errorf("Invalid prefix width '%s'", value)
+			}
+		case key == "count":
+			if f.count, err = strconv.Atoi(value); err != nil || !validWidth(f.count) {
+				return -1, f, fmt.Errorf("Invalid count width '%s'", value)
+			}
+		case key == "default":
+			if value == "" {
+				return -1, f, fmt.Errorf("Invalid default '%s'", value)
+			}
+			f.def = value
+		case key == "since":
+			if f.since, err = strconv.Atoi(value); err != nil || f.since <= 0 {
+				return -1, f, fmt.Errorf("Invalid since '%s'", value)
+			}
+		case key == "until":
+			if f.until, err = strconv.Atoi(value); err != nil || f.until <= 0 {
+				return -1, f, fmt.Errorf("Invalid until '%s'", value)
+			}
+		case option == "version":
+			f.version = true
+		case key == "skip":
+			if f.skip, err = strconv.Atoi(value); err != nil || f.skip <= 0 {
+				return -1, f, fmt.Errorf("Invalid skip '%s'", value)
+			}
+		case key == "pad":
+			var u64 uint64
+			if u64, err = strconv.ParseUint(value, 0, 8); err != nil {
+				return -1, f, fmt.Errorf("Invalid pad '%s'", value)
+			}
+			f.pad = byte(u64)
+		case key == "raw":
+			if value == "" {
+				return -1, f, fmt.Errorf("Invalid raw '%s'", value)
+			}
+			f.raw = value
+		case key == "window":
+			if value == "" {
+				return -1, f, fmt.Errorf("Invalid window '%s'", value)
+			}
+			f.window = value
+		case key == "term":
+			f.term, f.termText = true, value
+		case option == "peekterm":
+			f.peek = true
+		case key == "present":
+			name, bit, _ := strings.Cut(value, ":")
+			if f.bit, err = strconv.Atoi(bit); err != nil || name == "" || f.bit < 0 {
+				return -1, f, fmt.Errorf("Invalid present '%s'", value)
+			}
+			f.present = name
+		case key == "order":
+			if value != "auto" {
+				return -1, f, fmt.Errorf("Invalid order '%s'", value)
+			}
+			f.auto = true
+		case key == "magic":
+			inMagic = true
+			fallthrough
+		case inMagic && key == option:
+			var m magic
+			if m, err = parseMagic(strings.TrimPrefix(option, "magic=")); err != nil {
+				return -1, f, err
+			}
+			f.magics = append(f.magics, m)
+			continue
+		default:
+			return -1, f, fmt.Errorf("Unknown tag option '%s'", option)
 		}
+		inMagic = false
 	}
+	return
 }
 
-type valueStack []reflect.Value
+// parseMagic parses a magic option value such as 0x4949:le.
+func parseMagic(option string) (m magic, err error) {
+	value, name, _ := strings.Cut(option, ":")
+	if m.value, err = strconv.ParseUint(value, 0, 64); err != nil {
+		return m, fmt.Errorf("Invalid magic '%s'", option)
+	}
+	switch name {
+	case "be":
+		m.order = binary.BigEndian
+	case "le":
+		m.order = binary.LittleEndian
+	case "pdp":
+		m.order = PDPEndian
+	default:
+		return m, fmt.Errorf("Invalid magic order '%s'", option)
+	}
+	return m, nil
+}
 
-func (stack *valueStack) Push(value reflect.Value) {
-	*stack = append(*stack, value)
+func validWidth(bits int) bool {
+	return bits == 8 || bits == 16 || bits == 32 || bits == 64
 }
 
-func (stack *valueStack) Pop() (ret reflect.Value) {
-	size := len(*stack)
-	ret, *stack = (*stack)[size-1], (*stack)[0:size-1]
-	return
+type fieldsKey struct {
+	tpe     reflect.Type
+	tagName string
+}
+
+type fieldsEntry struct {
+	fields []field
+	err    error
 }
 
-func handleStructKind(cur *reflect.Value, tpe reflect.Type, stack *valueStack) (err error) {
+var fieldsCache sync.Map
+
+// structFields returns the encoded fields of struct type tpe in encoding order.
+func structFields(tpe reflect.Type, tagName string) ([]field, error) {
+	key := fieldsKey{tpe, tagName}
+	if entry, ok := fieldsCache.Load(key); ok {
+		return entry.(fieldsEntry).fields, entry.(fieldsEntry).err
+	}
+	fields, err := compileFields(tpe, tagName)
+	fieldsCache.Store(key, fieldsEntry{fields, err})
+	return fields, err
+}
+
+func compileFields(tpe reflect.Type, tagName string) ([]field, error) {
 	var (
-		numField     = cur.NumField()
-		fields       = make([]reflect.Value, numField)
-		idx          int
-		allowInvalid = true
+		numField = tpe.NumField()
+		ordered  = make([]*field, numField)
+		size     int
 	)
 
-	for i := 0; i < numField && err == nil; i++ {
-		tag := tpe.Field(i).Tag.Get(TagName)
-		idx, err = getIndexFromTag(tag, i)
+	for i := 0; i < numField; i++ {
+		sf := tpe.Field(i)
+		idx, f, err := parseTag(sf.Tag.Get(tagName), i)
 		switch {
 		case err != nil:
-			break
-		case idx == -1:
+			return nil, err
+		case idx == -1 || sf.Type == rawType:
 			continue
 		case idx >= numField:
-			err = fmt.Errorf("Field index '%d' out of range", idx)
-			break
-		case fields[numField-idx-1].IsValid():
-			err = fmt.Errorf("Field index '%d' duplicated", idx)
-			break
+			return nil, fmt.Errorf("Field index '%d' out of range", idx)
+		case ordered[idx] != nil:
+			return nil, fmt.Errorf("Field index '%d' duplicated", idx)
+		}
+		f.index, f.name = i, sf.Name
+		switch {
+		case sf.Name == "_" && f.skip > 0:
+			f.blank = true
+		case !sf.IsExported():
+			return nil, fmt.Errorf("Field %s: unexported field", f.name)
+		default:
+			if err = checkField(sf.Type, &f); err != nil {
+				return nil, err
+			}
+		}
+		ordered[idx] = &f
+		size++
+	}
+
+	fields := make([]field, size)
+	for i, f := range ordered {
+		switch {
+		case i < size && f == nil, i >= size && f != nil:
+			return nil, fmt.Errorf("Field indexes invalid")
+		case f != nil && f.rest && i != size-1:
+			return nil, fmt.Errorf("Field %s: rest must be the last field", f.name)
+		case f != nil:
+			fields[i] = *f
+		}
+	}
+	for i := range fields {
+		if fields[i].present != "" {
+			if err := bindPresence(tpe, fields, i); err != nil {
+				return nil, err
+			}
+		}
+		if fields[i].window != "" {
+			if err := bindWindow(tpe, fields, i); err != nil {
+				return nil, err
+			}
+		}
+		if fields[i].raw != "" {
+			if err := bindRaw(tpe, &fields[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fields, nil
+}
+
+// bindPresence binds the field i to the bit of its bitmap field, which must be encoded before it.
+func bindPresence(tpe reflect.Type, fields []field, i int) error {
+	f := &fields[i]
+	if tpe.Field(f.index).Type.Kind() != reflect.Ptr {
+		return fmt.Errorf("Field %s: present requires a pointer", f.name)
+	}
+	for j := 0; j < i; j++ {
+		if fields[j].name != f.present || fields[j].blank {
+			continue
+		}
+		switch bitmap := tpe.Field(fields[j].index).Type; bitmap.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if f.bit >= bitmap.Bits() {
+				return fmt.Errorf("Field %s: bit %d overflows bitmap %s", f.name, f.bit, f.present)
+			}
 		default:
-			fields[numField-idx-1] = cur.Field(i)
+			return fmt.Errorf("Field %s: bitmap %s requires a fixed-size unsigned integer", f.name, f.present)
 		}
+		f.bitmap = fields[j].index
+		fields[j].bits = append(fields[j].bits, presence{f.index, f.bit})
+		return nil
 	}
+	return fmt.Errorf("Field %s: bitmap %s is not encoded before it", f.name, f.present)
+}
 
-	if err == nil {
-		for _, field := range fields {
-			switch {
-			case allowInvalid && field.IsValid():
-				allowInvalid = false
-				stack.Push(field)
-			case !allowInvalid && !field.IsValid():
-				err = fmt.Errorf("Field indexes invalid")
-			case !allowInvalid && field.IsValid():
-				stack.Push(field)
+// bindWindow binds the field i to its length field, which must be encoded before it.
+func bindWindow(tpe reflect.Type, fields []field, i int) error {
+	f := &fields[i]
+	if f.rest {
+		return fmt.Errorf("Field %s: window and rest are exclusive", f.name)
+	}
+	for j := 0; j < i; j++ {
+		if fields[j].name != f.window || fields[j].blank {
+			continue
+		}
+		switch tpe.Field(fields[j].index).Type.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return fmt.Errorf("Field %s: window %s requires a fixed-size unsigned integer", f.name, f.window)
+		}
+		if fields[j].windowed != 0 {
+			return fmt.Errorf("Field %s: window %s already bounds field %s", f.name, f.window, fields[fields[j].windowed-1].name)
+		}
+		f.windowIndex = fields[j].index
+		fields[j].windowed = i + 1
+		return nil
+	}
+	return fmt.Errorf("Field %s: window %s is not encoded before it", f.name, f.window)
+}
+
+// isPresent reports whether the bit of the field f is set in the bitmap field of parent.
+func isPresent(parent reflect.Value, f *field) bool {
+	return parent.Field(f.bitmap).Uint()&(1<<uint(f.bit)) != 0
+}
+
+// bitmapOf returns the bitmap field cur of parent with the bits set for its present fields.
+func bitmapOf(parent, cur reflect.Value, f *field) reflect.Value {
+	bitmap := cur.Uint()
+	for _, p := range f.bits {
+		if parent.Field(p.index).IsNil() {
+			bitmap &^= 1 << uint(p.bit)
+		} else {
+			bitmap |= 1 << uint(p.bit)
+		}
+	}
+	value := reflect.New(cur.Type()).Elem()
+	value.SetUint(bitmap)
+	return value
+}
+
+// framedByTag reports whether the tag of the struct field f frames its bytes,
+// which opts the field in to the standard marshaler interfaces.
+func framedByTag(f *field) bool {
+	return f != nil && f != &rootField && (f.length > 0 || f.prefix > 0 || f.rest || f.window != "")
+}
+
+// framable reports whether values of type tpe can be framed by a len or prefix tag,
+// strings and the types implementing a standard marshaler interface.
+func framable(tpe reflect.Type) bool {
+	if tpe.Kind() == reflect.String {
+		return true
+	}
+	for _, t := range []reflect.Type{binaryMarshalerType, writerToType, binaryUnmarshalerType, readerFromType} {
+		if tpe.Implements(t) || reflect.PtrTo(tpe).Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkField reports whether the tag options of f suit a field of type tpe.
+func checkField(tpe reflect.Type, f *field) error {
+	for tpe.Kind() == reflect.Ptr {
+		tpe = tpe.Elem()
+	}
+	framings := 0
+	for _, framed := range []bool{f.length > 0, f.prefix > 0, f.rest, f.term} {
+		if framed {
+			framings++
+		}
+	}
+	if framings > 1 {
+		return fmt.Errorf("Field %s: len, prefix, rest and term are exclusive", f.name)
+	}
+	switch {
+	case f.length > 0 && !framable(tpe):
+		return fmt.Errorf("Field %s: len requires a string or a standard marshaler", f.name)
+	case f.prefix > 0 && !framable(tpe):
+		return fmt.Errorf("Field %s: prefix requires a string or a standard marshaler", f.name)
+	case f.count > 0 && tpe.Kind() != reflect.Map:
+		return fmt.Errorf("Field %s: count requires a map", f.name)
+	}
+	if err := checkTerm(tpe, f); err != nil {
+		return err
+	}
+	if f.auto != (len(f.magics) > 0) {
+		return fmt.Errorf("Field %s: order=auto and magic go together", f.name)
+	}
+	if f.auto {
+		width := magicWidth(tpe)
+		if width == 0 {
+			return fmt.Errorf("Field %s: magic requires an unsigned integer or a byte array of at most 8 bytes", f.name)
+		}
+		for _, m := range f.magics {
+			if m.value > maxUint(width*8) {
+				return fmt.Errorf("Field %s: magic %#x overflows %d byte(s)", f.name, m.value, width)
 			}
-			if err != nil {
-				break
+		}
+	}
+	if f.since > 0 && f.until > 0 && f.since > f.until {
+		return fmt.Errorf("Field %s: since %d exceeds until %d", f.name, f.since, f.until)
+	}
+	if f.version {
+		switch tpe.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return fmt.Errorf("Field %s: version requires a fixed-size integer", f.name)
+		}
+	}
+	if f.def != "" {
+		var err error
+		if f.defValue, err = parseValue(tpe, "default", f.def); err != nil {
+			return fmt.Errorf("Field %s: %v", f.name, err)
+		}
+	}
+	if f.min > 0 || f.max > 0 {
+		switch tpe.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			if !tpe.Implements(lengtherType) {
+				return fmt.Errorf("Field %s: min and max require a variable-length type", f.name)
 			}
 		}
+		if f.max > 0 && f.min > f.max {
+			return fmt.Errorf("Field %s: min %d exceeds max %d", f.name, f.min, f.max)
+		}
 	}
+	return nil
+}
 
+// checkTerm reports whether the terminator of f suits a field of type tpe.
+func checkTerm(tpe reflect.Type, f *field) (err error) {
+	switch {
+	case f.peek && f.termText == "":
+		return fmt.Errorf("Field %s: peekterm requires a term value", f.name)
+	case !f.term:
+		return nil
+	case tpe.Kind() != reflect.Slice:
+		return fmt.Errorf("Field %s: term requires a slice", f.name)
+	case f.termText == "":
+		if elem := tpe.Elem(); !elem.Implements(terminatorType) && !reflect.PtrTo(elem).Implements(terminatorType) {
+			return fmt.Errorf("Field %s: term requires a value or elements implementing Terminator", f.name)
+		}
+		return nil
+	case tpe.Elem().Kind() == reflect.String:
+		return fmt.Errorf("Field %s: term requires fixed-size elements", f.name)
+	}
+	if f.termValue, err = parseValue(tpe.Elem(), "term", f.termText); err != nil {
+		return fmt.Errorf("Field %s: %v", f.name, err)
+	}
+	return nil
+}
+
+// Terminator is the interface implemented by the elements of a slice which ends with a terminator element,
+// for a slice field tagged term without a value.
+type Terminator interface {
+	// IsTerminator reports whether the element ends the slice.
+	IsTerminator() bool
+}
+
+var terminatorType = reflect.TypeOf(new(Terminator)).Elem()
+
+// isTerminator reports whether the element cur ends the slice field f.
+func isTerminator(cur reflect.Value, f *field) bool {
+	if f.termValue.IsValid() {
+		return cur.Equal(f.termValue)
+	}
+	if !cur.Type().Implements(terminatorType) {
+		if !cur.CanAddr() {
+			addressable := reflect.New(cur.Type()).Elem()
+			addressable.Set(cur)
+			cur = addressable
+		}
+		cur = cur.Addr()
+	}
+	return cur.Interface().(Terminator).IsTerminator()
+}
+
+// parseValue parses the value s of the tag option of a field of type tpe.
+func parseValue(tpe reflect.Type, option, s string) (reflect.Value, error) {
+	var (
+		value = reflect.New(tpe).Elem()
+		err   error
+	)
+	switch tpe.Kind() {
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		value.SetBool(b)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(s, 0, tpe.Bits())
+		value.SetInt(n)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 0, tpe.Bits())
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(s, tpe.Bits())
+		value.SetFloat(n)
+	case reflect.String:
+		value.SetString(s)
+	default:
+		return value, fmt.Errorf("%s requires a boolean, fixed-size number or string", option)
+	}
+	if err != nil {
+		return value, fmt.Errorf("Invalid %s '%s'", option, s)
+	}
+	return value, nil
+}
+
+// defaultOf returns the default value of f as a value of type tpe, allocating the pointers.
+func defaultOf(tpe reflect.Type, f *field) reflect.Value {
+	if tpe.Kind() != reflect.Ptr {
+		return f.defValue
+	}
+	value := reflect.New(tpe.Elem())
+	value.Elem().Set(defaultOf(tpe.Elem(), f))
+	return value
+}
+
+// magicWidth returns the size in bytes of a magic field of type tpe, or 0 if tpe cannot hold a magic.
+func magicWidth(tpe reflect.Type) int {
+	switch tpe.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(tpe.Size())
+	case reflect.Array:
+		if tpe.Elem().Kind() == reflect.Uint8 && tpe.Len() > 0 && tpe.Len() <= 8 {
+			return tpe.Len()
+		}
+	}
+	return 0
+}
+
+// magicOrder returns the byte order selected by the magic value of the field f.
+func magicOrder(f *field, value uint64) (binary.ByteOrder, error) {
+	for _, m := range f.magics {
+		if m.value == value {
+			return m.order, nil
+		}
+	}
+	return nil, fmt.Errorf("Field %s: unknown magic %#x", f.name, value)
+}
+
+// scoped reports whether a field of struct type tpe selects the byte order or the version of the rest of the struct.
+func scoped(tpe reflect.Type, tagName string) bool {
+	fields, _ := structFields(tpe, tagName)
+	for _, f := range fields {
+		if f.auto || f.version {
+			return true
+		}
+	}
+	return false
+}
+
+// inVersion reports whether the field f is part of the protocol version, every field is part of version 0.
+func (f *field) inVersion(version int) bool {
+	return version == 0 || ((f.since == 0 || version >= f.since) && (f.until == 0 || version <= f.until))
+}
+
+// versionOf returns the protocol version held by the version field cur.
+func versionOf(cur reflect.Value) int {
+	for cur.Kind() == reflect.Ptr {
+		if cur.IsNil() {
+			return 0
+		}
+		cur = cur.Elem()
+	}
+	if cur.CanInt() {
+		return int(cur.Int())
+	}
+	return int(cur.Uint())
+}
+
+type lengther interface {
+	Len() int
+}
+
+var lengtherType = reflect.TypeOf(new(lengther)).Elem()
+
+// BoundError describes a variable-length field whose length violates its min or max tag.
+type BoundError struct {
+	Field  string
+	Bound  string
+	Limit  int
+	Length int
+}
+
+func (e *BoundError) Error() string {
+	return fmt.Sprintf("Field %s: length %d violates %s=%d", e.Field, e.Length, e.Bound, e.Limit)
+}
+
+// checkBounds reports whether the length of the field value cur is within the bounds of f.
+func checkBounds(cur reflect.Value, f *field) error {
+	if f.min == 0 && f.max == 0 {
+		return nil
+	}
+	for cur.Kind() == reflect.Ptr {
+		if cur.IsNil() {
+			return nil
+		}
+		cur = cur.Elem()
+	}
+	var length int
+	if l, ok := cur.Interface().(lengther); ok {
+		length = l.Len()
+	} else {
+		length = cur.Len()
+	}
+	switch {
+	case f.min > 0 && length < f.min:
+		return &BoundError{f.name, "min", f.min, length}
+	case f.max > 0 && length > f.max:
+		return &BoundError{f.name, "max", f.max, length}
+	}
+	return nil
+}
+
+// frame is an item of the traversal stack, either a value to process or
+// an action to run once the values pushed above it have been processed.
+// The parent of a struct field is the enclosing struct, it is invalid
+// for any other value. The path leads to the enclosing struct.
+type frame struct {
+	value  reflect.Value
+	field  *field
+	parent reflect.Value
+	path   *fieldPath
+	depth  int
+	action func() error
+}
+
+type frameStack []frame
+
+func (stack *frameStack) Push(f frame) {
+	*stack = append(*stack, f)
+}
+
+func (stack *frameStack) Pop() (ret frame) {
+	size := len(*stack)
+	ret, *stack = (*stack)[size-1], (*stack)[0:size-1]
 	return
 }
 
+func handleStructKind(cur *reflect.Value, tpe reflect.Type, tagName string, stack *frameStack, path *fieldPath, depth int) error {
+	fields, err := structFields(tpe, tagName)
+	if err != nil {
+		return err
+	}
+	for i := len(fields) - 1; i >= 0; i-- {
+		stack.Push(frame{value: cur.Field(fields[i].index), field: &fields[i], parent: *cur, path: path, depth: depth})
+	}
+	return nil
+}
+
+func countWidth(f *field) int {
+	if f == nil || f.count == 0 {
+		return defaultCount
+	}
+	return f.count
+}
+
+func writeCount(writer io.Writer, order binary.ByteOrder, bits int, n int) error {
+	if uint64(n) > maxUint(bits) {
+		return fmt.Errorf("Count %d overflows %d bits", n, bits)
+	}
+	buf := make([]byte, bits/8)
+	encodeUint(buf, order, uint64(n))
+	_, err := writer.Write(buf)
+	return err
+}
+
+// maxUint returns the maximum value of an unsigned integer of bits wide.
+func maxUint(bits int) uint64 {
+	if bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1<<uint(bits) - 1
+}
+
+// encodeUint encodes n as an unsigned integer of len(buf) bytes.
+func encodeUint(buf []byte, order binary.ByteOrder, n uint64) {
+	switch len(buf) {
+	case 1:
+		buf[0] = byte(n)
+	case 2:
+		order.PutUint16(buf, uint16(n))
+	case 4:
+		order.PutUint32(buf, uint32(n))
+	case 8:
+		order.PutUint64(buf, n)
+	}
+}
+
+// decodeUint decodes an unsigned integer of len(data) bytes.
+func decodeUint(data []byte, order binary.ByteOrder) uint64 {
+	switch len(data) {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(order.Uint16(data))
+	case 4:
+		return uint64(order.Uint32(data))
+	}
+	return order.Uint64(data)
+}
+
+// sortMapKeys sorts map keys so that maps encode deterministically.
+func sortMapKeys(keys []reflect.Value) (err error) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		c, e := compareKeys(keys[i], keys[j])
+		if e != nil && err == nil {
+			err = e
+		}
+		return c < 0
+	})
+	return
+}
+
+func compareKeys(a, b reflect.Value) (int, error) {
+	switch a.Kind() {
+	case reflect.Bool:
+		switch {
+		case a.Bool() == b.Bool():
+			return 0, nil
+		case b.Bool():
+			return -1, nil
+		}
+		return 1, nil
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int()), nil
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint(), b.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float(), b.Float()), nil
+
+	case reflect.Complex64, reflect.Complex128:
+		if c := compareOrdered(real(a.Complex()), real(b.Complex())); c != 0 {
+			return c, nil
+		}
+		return compareOrdered(imag(a.Complex()), imag(b.Complex())), nil
+
+	case reflect.String:
+		return compareOrdered(a.String(), b.String()), nil
+
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if c, err := compareKeys(a.Index(i), b.Index(i)); c != 0 || err != nil {
+				return c, err
+			}
+		}
+		return 0, nil
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if c, err := compareKeys(a.Field(i), b.Field(i)); c != 0 || err != nil {
+				return c, err
+			}
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Unsupported map key kind %s", a.Kind())
+}
+
+func compareOrdered[T int64 | uint64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
 type backfillReader struct {
-	buffer *bytes.Buffer
-	reader io.Reader
+	buffer  *bytes.Buffer
+	reader  io.Reader
+	records []*bytes.Buffer
 }
 
 func newBackfillReader(reader io.Reader) *backfillReader {
-	return &backfillReader{new(bytes.Buffer), reader}
+	return &backfillReader{buffer: new(bytes.Buffer), reader: reader}
 }
 
 func (backReader *backfillReader) Read(dst []byte) (int, error) {
-	if size, _ := backReader.buffer.Read(dst); size > 0 {
-		return size, nil
+	size, err := backReader.buffer.Read(dst)
+	if size == 0 {
+		size, err = backReader.reader.Read(dst)
+	} else {
+		err = nil
+	}
+	for _, record := range backReader.records {
+		record.Write(dst[:size])
 	}
-	return backReader.reader.Read(dst)
+	return size, err
 }
 
+// Backfill pushes src back to the front of the input.
 func (backReader *backfillReader) Backfill(src []byte) (n int, err error) {
-	return backReader.buffer.Write(src)
+	backReader.unrecord(len(src))
+	if backReader.buffer.Len() == 0 {
+		return backReader.buffer.Write(src)
+	}
+	backReader.buffer = bytes.NewBuffer(append(append([]byte{}, src...), backReader.buffer.Bytes()...))
+	return len(src), nil
+}
+
+// Record starts recording the bytes read, until Stop is called with the returned record.
+func (backReader *backfillReader) Record() *bytes.Buffer {
+	record := new(bytes.Buffer)
+	backReader.records = append(backReader.records, record)
+	return record
+}
+
+// Stop stops recording the bytes read into record.
+func (backReader *backfillReader) Stop(record *bytes.Buffer) {
+	for i := len(backReader.records) - 1; i >= 0; i-- {
+		if backReader.records[i] == record {
+			backReader.records = append(backReader.records[:i], backReader.records[i+1:]...)
+			break
+		}
+	}
+}
+
+// unrecord removes the last n bytes read, which are given back to the input, from the records.
+func (backReader *backfillReader) unrecord(n int) {
+	for _, record := range backReader.records {
+		if record.Len() < n {
+			record.Reset()
+		} else {
+			record.Truncate(record.Len() - n)
+		}
+	}
+}
+
+// Peek returns the next n bytes without consuming them.
+func (backReader *backfillReader) Peek(n int) ([]byte, error) {
+	if err := backReader.fill(n); err != nil {
+		return nil, err
+	}
+	switch buffered := backReader.buffer.Len(); {
+	case buffered == 0:
+		return nil, io.EOF
+	case buffered < n:
+		return nil, io.ErrUnexpectedEOF
+	}
+	return backReader.buffer.Bytes()[:n], nil
+}
+
+// AtEOF reports whether the input is exhausted, without consuming it.
+func (backReader *backfillReader) AtEOF() (bool, error) {
+	if err := backReader.fill(1); err != nil {
+		return false, err
+	}
+	return backReader.buffer.Len() == 0, nil
+}
+
+// fill buffers at least n bytes unless the input is exhausted first.
+// It reads a whole chunk at a time, so a following Read returns as many bytes as it would without buffering.
+func (backReader *backfillReader) fill(n int) error {
+	for backReader.buffer.Len() < n {
+		buf := make([]byte, defaultBufSize)
+		size, err := backReader.reader.Read(buf)
+		backReader.buffer.Write(buf[:size])
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package bin
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -23,82 +24,296 @@ type LittleEndianUnmarshaler interface {
 	UnmarshalLittleEndian(data []byte) (used int, err error)
 }
 
+// Unmarshaler is the interface implemented by types that can unmarshal the binary data description of themselves in the given byte order.
+// The input can be assumed to be a valid encoding of a binary value.
+// UnmarshalBin must copy the binary data if it wishes to retain the data after returning.
+type Unmarshaler interface {
+	UnmarshalBin(data []byte, order binary.ByteOrder) (used int, err error)
+}
+
+// StreamUnmarshaler is the interface implemented by types that can decode themselves by reading from a Decoder.
+// StreamUnmarshaler takes precedence over the other unmarshaler interfaces.
+type StreamUnmarshaler interface {
+	DecodeBin(d *Decoder) error
+}
+
 // UnmarshalBigEndian parses the big-endian binary data and stores the result in the value pointed to by ins.
 // If ins is nil or not a pointer, UnmarshalBigEndian returns an error.
 func UnmarshalBigEndian(input []byte, ins interface{}) error {
-	return unmarshal(bytes.NewBuffer(input), ins, binary.BigEndian, bigEndianUnmarshalerType, bigEndianUnmarshaler)
+	return (&Codec{Order: binary.BigEndian}).Unmarshal(input, ins)
 }
 
 // UnmarshalLittleEndian parses the little-endian binary data and stores the result in the value pointed to by ins.
 // If ins is nil or not a pointer, UnmarshalLittleEndian returns an error.
 func UnmarshalLittleEndian(input []byte, ins interface{}) error {
-	return unmarshal(bytes.NewBuffer(input), ins, binary.LittleEndian, littleEndianUnmarshalerType, littleEndianUnmarshaler)
+	return (&Codec{Order: binary.LittleEndian}).Unmarshal(input, ins)
 }
 
 // UnmarshalBigEndianFrom read and parses big-endian binary data from reader and stores the result in the value pointed to by ins.
 // If ins is nil or not a pointer, UnmarshalBigEndianFrom returns an error.
 func UnmarshalBigEndianFrom(reader io.Reader, ins interface{}) error {
-	return unmarshal(reader, ins, binary.BigEndian, bigEndianUnmarshalerType, bigEndianUnmarshaler)
+	return (&Codec{Order: binary.BigEndian}).UnmarshalFrom(reader, ins)
 }
 
 // UnmarshalLittleEndianFrom read and parses little-endian binary data from reader and stores the result in the value pointed to by ins.
 // If ins is nil or not a pointer, UnmarshalLittleEndianFrom returns an error.
 func UnmarshalLittleEndianFrom(reader io.Reader, ins interface{}) error {
-	return unmarshal(reader, ins, binary.LittleEndian, littleEndianUnmarshalerType, littleEndianUnmarshaler)
+	return (&Codec{Order: binary.LittleEndian}).UnmarshalFrom(reader, ins)
 }
 
 var (
+	binaryUnmarshalerType       = reflect.TypeOf(new(encoding.BinaryUnmarshaler)).Elem()
+	readerFromType              = reflect.TypeOf(new(io.ReaderFrom)).Elem()
+	streamUnmarshalerType       = reflect.TypeOf(new(StreamUnmarshaler)).Elem()
+	unmarshalerType             = reflect.TypeOf(new(Unmarshaler)).Elem()
 	bigEndianUnmarshalerType    = reflect.TypeOf(new(BigEndianUnmarshaler)).Elem()
 	littleEndianUnmarshalerType = reflect.TypeOf(new(LittleEndianUnmarshaler)).Elem()
 )
 
-type unmarshalerFunc func(interface{}, []byte) (int, error)
+type unmarshalerFunc func(interface{}, []byte, binary.ByteOrder) (int, error)
 
-func bigEndianUnmarshaler(v interface{}, data []byte) (used int, err error) {
-	unmarshaler := v.(BigEndianUnmarshaler)
-	return unmarshaler.UnmarshalBigEndian(data)
+func bigEndianUnmarshaler(v interface{}, data []byte, order binary.ByteOrder) (used int, err error) {
+	if unmarshaler, ok := v.(BigEndianUnmarshaler); ok {
+		return unmarshaler.UnmarshalBigEndian(data)
+	}
+	return v.(Unmarshaler).UnmarshalBin(data, order)
 }
 
-func littleEndianUnmarshaler(v interface{}, data []byte) (used int, err error) {
-	unmarshaler := v.(LittleEndianUnmarshaler)
-	return unmarshaler.UnmarshalLittleEndian(data)
+func littleEndianUnmarshaler(v interface{}, data []byte, order binary.ByteOrder) (used int, err error) {
+	if unmarshaler, ok := v.(LittleEndianUnmarshaler); ok {
+		return unmarshaler.UnmarshalLittleEndian(data)
+	}
+	return v.(Unmarshaler).UnmarshalBin(data, order)
 }
 
-func unmarshal(reader io.Reader, ins interface{}, order binary.ByteOrder, unmarshalerType reflect.Type, unmarshaler unmarshalerFunc) error {
-	var (
-		stack      valueStack
-		cur        reflect.Value
-		tpe        reflect.Type
-		kind       reflect.Kind
-		err        error
-		buf        []byte
-		backReader = newBackfillReader(reader)
-		size       int
-		delta      int
-	)
+func binUnmarshaler(v interface{}, data []byte, order binary.ByteOrder) (used int, err error) {
+	return v.(Unmarshaler).UnmarshalBin(data, order)
+}
+
+// Decoder reads binary values from the input of one unmarshal call.
+// A Decoder is passed to the DecodeBin method of StreamUnmarshaler implementations,
+// its reads are bound by the Limits of the Codec.
+type Decoder struct {
+	codec       *Codec
+	reader      *backfillReader
+	order       binary.ByteOrder
+	endianType  reflect.Type
+	unmarshaler unmarshalerFunc
+	stack       frameStack
+	depth       int
+	version     int
+
+	read, alloc, elements uint64
+}
 
-	cur = reflect.ValueOf(ins)
+// Decode parses the binary data in the given byte order, binary.BigEndian if nil,
+// and returns the decoded value of type T with the number of bytes it used.
+func Decode[T any](data []byte, order binary.ByteOrder) (T, int, error) {
+	var ins T
+	d := newDecoder(bytes.NewReader(data), &Codec{Order: order})
+	if err := d.decode(frame{value: reflect.ValueOf(&ins), field: &rootField}); err != nil {
+		var zero T
+		return zero, 0, err
+	}
+	return ins, int(d.read), nil
+}
+
+// DecodeFrom reads and parses binary data in the given byte order, binary.BigEndian if nil,
+// from reader and returns the decoded value of type T.
+func DecodeFrom[T any](reader io.Reader, order binary.ByteOrder) (T, error) {
+	var ins T
+	if err := newDecoder(reader, &Codec{Order: order}).decode(frame{value: reflect.ValueOf(&ins), field: &rootField}); err != nil {
+		var zero T
+		return zero, err
+	}
+	return ins, nil
+}
+
+func unmarshal(reader io.Reader, ins interface{}, codec *Codec) error {
+	cur := reflect.ValueOf(ins)
 	if cur.Kind() != reflect.Ptr || cur.IsNil() {
 		return fmt.Errorf("Invalid Unmarshal Type %#v", ins)
 	}
+	return newDecoder(reader, codec).decode(frame{value: cur, field: &rootField})
+}
 
-	stack.Push(cur)
-	for len(stack) > 0 && err == nil {
-		cur = stack.Pop()
+// unmarshalerOf returns the endian-specific unmarshaler interface of order and the function calling it.
+// The interface is nil for an order which is neither big-endian nor little-endian.
+func unmarshalerOf(order binary.ByteOrder) (reflect.Type, unmarshalerFunc) {
+	switch {
+	case order == binary.BigEndian || sameOrder(order, binary.BigEndian):
+		return bigEndianUnmarshalerType, bigEndianUnmarshaler
+	case order == binary.LittleEndian || sameOrder(order, binary.LittleEndian):
+		return littleEndianUnmarshalerType, littleEndianUnmarshaler
+	}
+	return nil, binUnmarshaler
+}
+
+func newDecoder(reader io.Reader, codec *Codec) *Decoder {
+	d := &Decoder{codec: codec, reader: newBackfillReader(reader), version: codec.Version}
+	d.setOrder(codec.order())
+	return d
+}
+
+func (d *Decoder) setOrder(order binary.ByteOrder) {
+	d.order = order
+	d.endianType, d.unmarshaler = unmarshalerOf(order)
+}
+
+// Order returns the byte order of the input.
+func (d *Decoder) Order() binary.ByteOrder {
+	return d.order
+}
+
+// Version returns the protocol version of the input, zero if every field is decoded.
+func (d *Decoder) Version() int {
+	return d.version
+}
+
+// ReadUint8 reads an unsigned integer of 8 bits.
+func (d *Decoder) ReadUint8() (uint8, error) {
+	n, err := d.readUint(1)
+	return uint8(n), err
+}
+
+// ReadUint16 reads an unsigned integer of 16 bits.
+func (d *Decoder) ReadUint16() (uint16, error) {
+	n, err := d.readUint(2)
+	return uint16(n), err
+}
+
+// ReadUint32 reads an unsigned integer of 32 bits.
+func (d *Decoder) ReadUint32() (uint32, error) {
+	n, err := d.readUint(4)
+	return uint32(n), err
+}
+
+// ReadUint64 reads an unsigned integer of 64 bits.
+func (d *Decoder) ReadUint64() (uint64, error) {
+	return d.readUint(8)
+}
+
+// ReadBytes reads exactly n bytes.
+// The memory grows with the bytes actually read, so a truncated input fails before n bytes are allocated.
+func (d *Decoder) ReadBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Invalid length %d", n)
+	}
+	if err := d.chargeAlloc(uint64(n)); err != nil {
+		return nil, err
+	}
+	if err := d.chargeRead(n); err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(d.reader, int64(n)))
+	if err == nil && len(buf) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
+// Decode decodes the value pointed to by ins from the input,
+// as if it was a nested value of the one being decoded.
+func (d *Decoder) Decode(ins interface{}) error {
+	cur := reflect.ValueOf(ins)
+	if cur.Kind() != reflect.Ptr || cur.IsNil() {
+		return fmt.Errorf("Invalid Decode Type %#v", ins)
+	}
+	return d.decode(frame{value: cur, depth: d.depth})
+}
+
+// decode decodes the value of root and everything it pushes onto the stack.
+func (d *Decoder) decode(root frame) error {
+	var (
+		top   frame
+		tpe   reflect.Type
+		kind  reflect.Kind
+		err   error
+		buf   []byte
+		count uint64
+		cur   reflect.Value
+		base  = len(d.stack)
+	)
 
+	d.stack.Push(root)
+	for len(d.stack) > base && err == nil {
+		top = d.stack.Pop()
+		if top.action != nil {
+			err = top.action()
+			continue
+		}
+		if d.codec.MaxDepth > 0 && top.depth > d.codec.MaxDepth {
+			err = fmt.Errorf("%w: MaxDepth %d", ErrLimitExceeded, d.codec.MaxDepth)
+			break
+		}
+		cur = top.value
+		if top.parent.IsValid() && !top.field.inVersion(d.version) {
+			continue
+		}
+		if top.parent.IsValid() && top.field.present != "" && !isPresent(top.parent, top.field) {
+			cur.Set(reflect.Zero(cur.Type()))
+			continue
+		}
+		if top.parent.IsValid() && top.field.blank {
+			err = d.skip(top.field.skip)
+			continue
+		}
+		if top.parent.IsValid() && top.field.raw != "" {
+			d.stack.Push(frame{action: d.captureRaw(top)})
+		}
 		tpe = cur.Type()
 		kind = cur.Kind()
-		if tpe.Implements(unmarshalerType) {
-			if kind == reflect.Ptr && cur.IsNil() {
-				cur.Set(reflect.New(tpe.Elem()))
+		if hasValidator(tpe) {
+			d.stack.Push(frame{action: validateAction(top)})
+		}
+		if top.parent.IsValid() {
+			if top.field.version {
+				d.stack.Push(frame{action: d.versionAction(cur)})
 			}
-			buf = make([]byte, defaultBufSize)
-			if size, err = backReader.Read(buf); err != nil {
-				continue
+			d.enterField(top)
+			if top.field.defValue.IsValid() {
+				var absent bool
+				if absent, err = d.reader.AtEOF(); err != nil {
+					break
+				} else if absent {
+					cur.Set(defaultOf(tpe, top.field))
+					continue
+				}
 			}
-			if delta, err = unmarshaler(cur.Interface(), buf[0:size]); err == nil {
-				_, err = backReader.Backfill(buf[delta:size])
+			if top.field.window != "" {
+				if err = d.enterWindow(top); err != nil {
+					break
+				}
 			}
+			if top.field.skip > 0 {
+				if err = d.skip(top.field.skip); err != nil {
+					break
+				}
+			}
+		}
+
+		if top.field != nil && top.field.auto && kind != reflect.Ptr {
+			err = d.readMagic(cur, top.field)
+			continue
+		}
+		if decode := d.codec.lookup(tpe).decode; decode != nil && cur.CanAddr() {
+			depth := d.depth
+			d.depth = top.depth + 1
+			err = decode(d, cur.Addr().Interface())
+			d.depth = depth
+			continue
+		}
+		if kind != reflect.Ptr && cur.CanAddr() && d.isUnmarshaler(reflect.PtrTo(tpe), top.field) {
+			cur, tpe, kind = cur.Addr(), reflect.PtrTo(tpe), reflect.Ptr
+		}
+		if d.isUnmarshaler(tpe, top.field) {
+			if kind == reflect.Ptr && cur.IsNil() {
+				cur.Set(reflect.New(tpe.Elem()))
+			}
+			depth := d.depth
+			d.depth = top.depth + 1
+			err = d.callUnmarshaler(cur.Interface(), top.field)
+			d.depth = depth
 			continue
 		}
 
@@ -107,14 +322,47 @@ func unmarshal(reader io.Reader, ins interface{}, order binary.ByteOrder, unmars
 			if cur.IsNil() {
 				cur.Set(reflect.New(tpe.Elem()))
 			}
-			stack.Push(cur.Elem())
+			d.stack.Push(frame{value: cur.Elem(), field: top.field, path: top.path, depth: top.depth + 1})
 
 		case reflect.Struct:
-			err = handleStructKind(&cur, tpe, &stack)
+			if scoped(tpe, d.codec.tagName()) {
+				d.stack.Push(frame{action: d.restoreScope(d.order, d.version)})
+			}
+			err = handleStructKind(&cur, tpe, d.codec.tagName(), &d.stack, top.extend(), top.depth+1)
 
 		case reflect.Slice, reflect.Array:
+			if kind == reflect.Slice && top.field != &rootField && top.field != nil && top.field.rest {
+				err = d.readRestSlice(cur, top.extend(), top.depth+1)
+				break
+			}
+			if kind == reflect.Slice && top.field != nil && top.field.term {
+				cur.Set(reflect.MakeSlice(tpe, 0, 0))
+				d.stack.Push(frame{action: d.termElements(cur, top.field, top.extend(), top.depth+1)})
+				break
+			}
+			path := top.extend()
 			for i := cur.Len() - 1; i >= 0; i-- {
-				stack.Push(cur.Index(i))
+				d.stack.Push(frame{value: cur.Index(i), path: path, depth: top.depth + 1})
+			}
+
+		case reflect.Map:
+			if count, err = d.readCount(countWidth(top.field)); err != nil {
+				break
+			}
+			if err = d.chargeElements(count); err != nil {
+				break
+			}
+			if err = d.chargeAlloc(count, uint64(tpe.Key().Size()+tpe.Elem().Size())); err != nil {
+				break
+			}
+			cur.Set(reflect.MakeMap(tpe))
+			if count > 0 {
+				d.stack.Push(frame{action: d.mapEntries(cur, count, top.extend(), top.depth+1)})
+			}
+
+		case reflect.String:
+			if buf, err = d.readString(top.field); err == nil {
+				cur.SetString(string(buf))
 			}
 
 		case reflect.Bool,
@@ -122,9 +370,8 @@ func unmarshal(reader io.Reader, ins interface{}, order binary.ByteOrder, unmars
 			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 			reflect.Float32, reflect.Float64,
 			reflect.Complex64, reflect.Complex128:
-			buf = make([]byte, tpe.Size())
-			if _, err = io.ReadFull(backReader, buf); err == nil {
-				setValue(&cur, kind, order, buf)
+			if buf, err = d.readFull(int(tpe.Size())); err == nil {
+				setValue(&cur, kind, d.order, buf)
 			}
 
 		default:
@@ -135,6 +382,405 @@ func unmarshal(reader io.Reader, ins interface{}, order binary.ByteOrder, unmars
 	return err
 }
 
+// isUnmarshaler reports whether tpe implements an unmarshaler interface for a value described by f,
+// the standard interfaces only count for a field framed by its tag.
+func (d *Decoder) isUnmarshaler(tpe reflect.Type, f *field) bool {
+	interfaces := []reflect.Type{streamUnmarshalerType, d.endianType, unmarshalerType}
+	if framedByTag(f) {
+		interfaces = append(interfaces, binaryUnmarshalerType, readerFromType)
+	}
+	for _, t := range interfaces {
+		if t != nil && tpe.Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// callUnmarshaler decodes v with the first unmarshaler interface it implements,
+// the standard interfaces are given the bytes framed as described by f.
+func (d *Decoder) callUnmarshaler(v interface{}, f *field) error {
+	tpe := reflect.TypeOf(v)
+	if unmarshaler, ok := v.(StreamUnmarshaler); ok {
+		return unmarshaler.DecodeBin(d)
+	}
+	if (d.endianType != nil && tpe.Implements(d.endianType)) || tpe.Implements(unmarshalerType) {
+		return d.unmarshalWindow(v)
+	}
+	data, err := d.readFramed(f)
+	if err != nil {
+		return err
+	}
+	switch unmarshaler := v.(type) {
+	case encoding.BinaryUnmarshaler:
+		return unmarshaler.UnmarshalBinary(data)
+	case io.ReaderFrom:
+		_, err = unmarshaler.ReadFrom(bytes.NewReader(data))
+	}
+	return err
+}
+
+// unmarshalWindow decodes v with its endian-specific or Unmarshaler method.
+// The unmarshaler sees at most defaultBufSize bytes, so the bytes it used are charged after the fact.
+func (d *Decoder) unmarshalWindow(v interface{}) error {
+	buf := make([]byte, defaultBufSize)
+	size, err := d.reader.Read(buf)
+	if err != nil && (err != io.EOF || size == 0) {
+		return err
+	}
+	used, err := d.unmarshaler(v, buf[0:size], d.order)
+	switch {
+	case err != nil:
+		return err
+	case used < 0 || used > size:
+		return fmt.Errorf("Invalid used size %d of %d byte(s)", used, size)
+	}
+	if err = d.chargeRead(used); err == nil {
+		if err = d.chargeAlloc(uint64(used)); err == nil {
+			_, err = d.reader.Backfill(buf[used:size])
+		}
+	}
+	return err
+}
+
+// readFramed reads the bytes of a value framed as described by f.
+func (d *Decoder) readFramed(f *field) (buf []byte, err error) {
+	switch {
+	case f != nil && f.rest:
+		buf, err = d.readRest()
+	case f != nil && f.length > 0:
+		buf, err = d.ReadBytes(f.length)
+	case f != nil && f.prefix > 0:
+		_, buf, err = d.readPrefixed(f.prefix)
+	case f != nil && f.window != "":
+		buf, err = d.readRest()
+	default:
+		err = fmt.Errorf("Value requires a len, prefix, rest or window tag")
+	}
+	return
+}
+
+// captureRaw records the bytes read for the field top and returns an action
+// which stores them in its Raw field once the field is decoded.
+func (d *Decoder) captureRaw(top frame) func() error {
+	reader := d.reader
+	record := reader.Record()
+	return func() error {
+		reader.Stop(record)
+		if err := d.chargeAlloc(uint64(record.Len())); err != nil {
+			return err
+		}
+		top.parent.Field(top.field.rawIndex).SetBytes(record.Bytes())
+		return nil
+	}
+}
+
+// enterWindow confines the decoding of the field top to the bytes counted by its length field.
+// The bytes of the window left once the field is decoded are skipped.
+func (d *Decoder) enterWindow(top frame) error {
+	length := top.parent.Field(top.field.windowIndex).Uint()
+	if length > uint64(math.MaxInt) {
+		return fmt.Errorf("Field %s: invalid window length %d", top.field.name, length)
+	}
+	buf, err := d.ReadBytes(int(length))
+	if err != nil {
+		return err
+	}
+	// the bytes of the window are charged again as they are decoded
+	reader, read := d.reader, d.read
+	d.reader, d.read, d.alloc = newBackfillReader(bytes.NewReader(buf)), read-length, d.alloc-length
+	d.stack.Push(frame{action: func() error {
+		d.reader, d.read = reader, read
+		return nil
+	}})
+	return nil
+}
+
+// readMagic reads the magic value of the field cur and switches to the byte order it selects.
+func (d *Decoder) readMagic(cur reflect.Value, f *field) error {
+	buf, err := d.readFull(magicWidth(cur.Type()))
+	if err != nil {
+		return err
+	}
+	var value uint64
+	for _, b := range buf {
+		value = value<<8 | uint64(b)
+	}
+	order, err := magicOrder(f, value)
+	if err != nil {
+		return err
+	}
+	if cur.Kind() == reflect.Array {
+		reflect.Copy(cur, reflect.ValueOf(buf))
+	} else {
+		cur.SetUint(value)
+	}
+	d.setOrder(order)
+	return nil
+}
+
+// restoreScope returns an action which switches back to order and version
+// once a struct with a magic or version field is decoded.
+func (d *Decoder) restoreScope(order binary.ByteOrder, version int) func() error {
+	return func() error {
+		d.setOrder(order)
+		d.version = version
+		return nil
+	}
+}
+
+// versionAction returns an action which switches to the protocol version held by cur once it is decoded.
+func (d *Decoder) versionAction(cur reflect.Value) func() error {
+	return func() error {
+		d.version = versionOf(cur)
+		return nil
+	}
+}
+
+// validateAction returns an action which validates the value of top once it is decoded.
+func validateAction(top frame) func() error {
+	return func() error {
+		return validate(top)
+	}
+}
+
+// enterField schedules the checks of the struct field top once it is decoded.
+func (d *Decoder) enterField(top frame) {
+	if top.field.min > 0 || top.field.max > 0 {
+		d.stack.Push(frame{action: func() error {
+			return checkBounds(top.value, top.field)
+		}})
+	}
+}
+
+// charge adds n to used, or returns ErrLimitExceeded if the sum exceeds a positive limit.
+func charge(used *uint64, n uint64, limit int, name string) error {
+	if limit > 0 && (n > uint64(limit) || *used > uint64(limit)-n) {
+		return fmt.Errorf("%w: %s %d", ErrLimitExceeded, name, limit)
+	}
+	*used += n
+	return nil
+}
+
+func (d *Decoder) chargeRead(n int) error {
+	return charge(&d.read, uint64(n), d.codec.MaxBytes, "MaxBytes")
+}
+
+// chargeAlloc charges the product of sizes to the allocated bytes.
+func (d *Decoder) chargeAlloc(sizes ...uint64) error {
+	n := uint64(1)
+	for _, size := range sizes {
+		if size != 0 && n > math.MaxUint64/size {
+			return fmt.Errorf("%w: MaxAlloc %d", ErrLimitExceeded, d.codec.MaxAlloc)
+		}
+		n *= size
+	}
+	return charge(&d.alloc, n, d.codec.MaxAlloc, "MaxAlloc")
+}
+
+func (d *Decoder) chargeElements(n uint64) error {
+	return charge(&d.elements, n, d.codec.MaxElements, "MaxElements")
+}
+
+// skip discards n bytes of the input without allocating them.
+func (d *Decoder) skip(n int) error {
+	if err := d.chargeRead(n); err != nil {
+		return err
+	}
+	if skipped, err := io.CopyN(io.Discard, d.reader, int64(n)); skipped < int64(n) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// readFull reads exactly n bytes.
+func (d *Decoder) readFull(n int) ([]byte, error) {
+	if err := d.chargeRead(n); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.reader, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readRest reads the rest of the input, failing as soon as it exceeds the limits.
+func (d *Decoder) readRest() ([]byte, error) {
+	remaining := int64(math.MaxInt64)
+	if limit := d.codec.MaxBytes; limit > 0 {
+		remaining = int64(uint64(limit) - d.read)
+	}
+	if limit := d.codec.MaxAlloc; limit > 0 && int64(uint64(limit)-d.alloc) < remaining {
+		remaining = int64(uint64(limit) - d.alloc)
+	}
+	if remaining < math.MaxInt64 {
+		remaining++
+	}
+	buf, err := io.ReadAll(io.LimitReader(d.reader, remaining))
+	if err != nil {
+		return nil, err
+	}
+	if err = d.chargeRead(len(buf)); err != nil {
+		return nil, err
+	}
+	if err = d.chargeAlloc(uint64(len(buf))); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readUint reads an unsigned integer of size bytes.
+func (d *Decoder) readUint(size int) (uint64, error) {
+	buf, err := d.readFull(size)
+	if err != nil {
+		return 0, err
+	}
+	return decodeUint(buf, d.order), nil
+}
+
+func (d *Decoder) readCount(bits int) (uint64, error) {
+	return d.readUint(bits / 8)
+}
+
+// readPrefixed reads a value prefixed by its length as an unsigned integer of bits wide.
+func (d *Decoder) readPrefixed(bits int) (length uint64, value []byte, err error) {
+	if length, err = d.readCount(bits); err != nil {
+		return
+	}
+	if length > uint64(math.MaxInt) {
+		err = fmt.Errorf("Invalid length %d", length)
+		return
+	}
+	value, err = d.ReadBytes(int(length))
+	return
+}
+
+// readString reads the bytes of a string framed as described by f.
+// The trailing NUL padding of a fixed length string is trimmed.
+func (d *Decoder) readString(f *field) (buf []byte, err error) {
+	if buf, err = d.readFramed(f); err == nil && f.length > 0 {
+		buf = bytes.TrimRight(buf, "\x00")
+	}
+	return
+}
+
+// readRestSlice replaces the elements of the slice cur with the elements spanning the rest of the input.
+func (d *Decoder) readRestSlice(cur reflect.Value, path *fieldPath, depth int) error {
+	if cur.Type().Elem().Kind() == reflect.Uint8 {
+		buf, err := d.readRest()
+		if err == nil {
+			cur.SetBytes(buf)
+		}
+		return err
+	}
+	cur.Set(reflect.MakeSlice(cur.Type(), 0, 0))
+	d.stack.Push(frame{action: d.restElements(cur, path, depth)})
+	return nil
+}
+
+// restElements returns an action which decodes the next element of the slice s unless the input is exhausted,
+// and schedules itself for the following elements.
+func (d *Decoder) restElements(s reflect.Value, path *fieldPath, depth int) func() error {
+	return func() error {
+		if absent, err := d.reader.AtEOF(); err != nil || absent {
+			return err
+		}
+		if err := d.chargeElements(1); err != nil {
+			return err
+		}
+		if err := d.chargeAlloc(uint64(s.Type().Elem().Size())); err != nil {
+			return err
+		}
+		read := d.read
+		s.Set(reflect.Append(s, reflect.New(s.Type().Elem()).Elem()))
+		d.stack.Push(frame{action: func() error {
+			if d.read == read {
+				return fmt.Errorf("Element %s of rest slice consumes no input", s.Type().Elem())
+			}
+			d.stack.Push(frame{action: d.restElements(s, path, depth)})
+			return nil
+		}})
+		d.stack.Push(frame{value: s.Index(s.Len() - 1), path: path, depth: depth})
+		return nil
+	}
+}
+
+// termElements returns an action which decodes the next element of the slice s unless it is the terminator of f,
+// and schedules itself for the following elements.
+func (d *Decoder) termElements(s reflect.Value, f *field, path *fieldPath, depth int) func() error {
+	return func() error {
+		if err := d.chargeElements(1); err != nil {
+			return err
+		}
+		if err := d.chargeAlloc(uint64(s.Type().Elem().Size())); err != nil {
+			return err
+		}
+		if f.termValue.IsValid() {
+			if term, err := d.peekTerm(f); err != nil || term {
+				return err
+			}
+		}
+		read := d.read
+		s.Set(reflect.Append(s, reflect.New(s.Type().Elem()).Elem()))
+		d.stack.Push(frame{action: func() error {
+			if !f.termValue.IsValid() && isTerminator(s.Index(s.Len()-1), f) {
+				s.Set(s.Slice(0, s.Len()-1))
+				return nil
+			}
+			if d.read == read {
+				return fmt.Errorf("Element %s of term slice consumes no input", s.Type().Elem())
+			}
+			d.stack.Push(frame{action: d.termElements(s, f, path, depth)})
+			return nil
+		}})
+		d.stack.Push(frame{value: s.Index(s.Len() - 1), path: path, depth: depth})
+		return nil
+	}
+}
+
+// peekTerm reports whether the input continues with the terminator value of f.
+// The terminator is consumed unless f is tagged peekterm, other bytes are left in the input.
+func (d *Decoder) peekTerm(f *field) (bool, error) {
+	term := new(bytes.Buffer)
+	if err := binary.Write(term, d.order, f.termValue.Interface()); err != nil {
+		return false, err
+	}
+	buf, err := d.reader.Peek(term.Len())
+	if err != nil || !bytes.Equal(buf, term.Bytes()) {
+		return false, err
+	}
+	if !f.peek {
+		_, err = d.readFull(term.Len())
+	}
+	return err == nil, err
+}
+
+// mapEntries returns an action which decodes the next key/value pair of m,
+// inserts it once decoded and schedules itself for the remaining pairs.
+func (d *Decoder) mapEntries(m reflect.Value, count uint64, path *fieldPath, depth int) func() error {
+	return func() error {
+		key := reflect.New(m.Type().Key()).Elem()
+		value := reflect.New(m.Type().Elem()).Elem()
+		d.stack.Push(frame{action: func() error {
+			if m.MapIndex(key).IsValid() {
+				return fmt.Errorf("Duplicated map key %v", key)
+			}
+			m.SetMapIndex(key, value)
+			if count--; count > 0 {
+				d.stack.Push(frame{action: d.mapEntries(m, count, path, depth)})
+			}
+			return nil
+		}})
+		d.stack.Push(frame{value: value, path: path, depth: depth})
+		d.stack.Push(frame{value: key, path: path, depth: depth})
+		return nil
+	}
+}
+
 func setValue(cur *reflect.Value, kind reflect.Kind, order binary.ByteOrder, data []byte) {
 	switch kind {
 	case reflect.Bool:
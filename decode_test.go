@@ -2,7 +2,11 @@ package bin
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"reflect"
 	"testing"
 )
@@ -225,9 +229,72 @@ func TestUnmarshalPtr(t *testing.T) {
 
 func TestUnmarshalUnsupportedKind(t *testing.T) {
 	var (
-		ins string
+		ins int
 	)
-	if e := UnmarshalBigEndian([]byte("Unsupported"), &ins); e == nil {
+	if e := UnmarshalBigEndian([]byte{0, 0, 0, 0, 0, 0, 0, 1}, &ins); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
+
+func TestUnmarshalString(t *testing.T) {
+	type inTest struct {
+		Name  string `bin:"len=8"`
+		Ver   byte
+		Extra string `bin:"rest"`
+	}
+	var (
+		ins    inTest
+		except = inTest{"eth0", 4, "payload"}
+		plain  string
+	)
+	if e := UnmarshalBigEndian([]byte("eth0\x00\x00\x00\x00\x04payload"), &ins); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(ins, except) {
+		t.Errorf("except %#v, but got %#v", except, ins)
+	}
+
+	if e := UnmarshalBigEndian([]byte("whole input"), &plain); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if plain != "whole input" {
+		t.Errorf("except %v, but got %v", "whole input", plain)
+	}
+}
+
+func TestUnmarshalStringError(t *testing.T) {
+	for i, caze := range []struct {
+		ins  interface{}
+		data []byte
+	}{
+		{&struct{ Name string }{}, []byte("name")},
+		{&struct {
+			Name string `bin:"len=8"`
+		}{}, []byte("name")},
+		{&struct {
+			Name string `bin:"rest"`
+			Ver  byte
+		}{}, []byte("name")},
+		{&struct {
+			Names []string `bin:"len=4"`
+		}{Names: make([]string, 1)}, []byte("name")},
+		{&struct {
+			Data []byte `bin:"len=4"`
+		}{}, []byte("name")},
+		{&struct {
+			Data []byte `bin:"prefix=8"`
+		}{}, []byte{3, 1, 2, 3}},
+	} {
+		if e := UnmarshalBigEndian(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+func TestUnmarshalUnexportedField(t *testing.T) {
+	var ins struct {
+		Ver  byte
+		port uint16
+	}
+	if e := UnmarshalBigEndian([]byte{5, 4, 56}, &ins); e == nil {
 		t.Errorf("except some error, but got nil")
 	}
 }
@@ -356,3 +423,858 @@ func TestUnmarshalFrom(t *testing.T) {
 		t.Errorf("except %#v, but got %#v", except, ins)
 	}
 }
+
+func TestUnmarshalMap(t *testing.T) {
+	type inTest struct {
+		Settings map[uint16]uint32 `bin:"count=8"`
+		Names    map[byte]Bytes8   `bin:"count=16"`
+	}
+	var (
+		ins    inTest
+		except = inTest{
+			map[uint16]uint32{1: 4096, 3: 100},
+			map[byte]Bytes8{7: Bytes8("ab")},
+		}
+	)
+	if e := UnmarshalBigEndian([]byte{2, 0, 1, 0, 0, 16, 0, 0, 3, 0, 0, 0, 100, 0, 1, 7, 2, 97, 98}, &ins); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(ins, except) {
+		t.Errorf("except %#v, but got %#v", except, ins)
+	}
+
+	var m map[uint16]uint16
+	if e := UnmarshalLittleEndian([]byte{0, 0, 0, 0}, &m); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if m == nil || len(m) != 0 {
+		t.Errorf("except empty map, but got %#v", m)
+	}
+}
+
+func TestUnmarshalMapError(t *testing.T) {
+	var m map[byte]byte
+	for i, bs := range [][]byte{
+		{0, 0, 0},
+		{0, 0, 0, 2, 1, 1},
+		{0, 0, 0, 2, 1, 1, 1, 2},
+	} {
+		if e := UnmarshalBigEndian(bs, &m); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+	if e := UnmarshalBigEndian([]byte{1}, &struct {
+		X uint8 `bin:"count=8"`
+	}{}); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
+
+func FuzzUnmarshalStruct(f *testing.F) {
+	type pair struct {
+		Key   uint16
+		Value *uint32
+	}
+	type inTest struct {
+		Ver     byte
+		Flags   [2]bool
+		Pairs   [2]pair
+		Name    string `bin:"len=4"`
+		Methods Bytes8
+		Host    *String16
+		Attrs   map[uint8]Bytes8 `bin:"count=8"`
+		Data    *Bytes32
+		Ratio   float32
+		Point   complex64
+		Extra   string `bin:"rest"`
+	}
+	for _, seed := range [][]byte{
+		{},
+		{5, 1, 0, 0, 1, 0, 0, 0, 2, 0, 3, 0, 0, 0, 4, 'e', 't', 'h', '0', 1, 0, 0, 1, 'a', 1, 7, 1, 'b', 0, 0, 0, 0},
+		{5, 1, 0, 0, 1, 0, 0, 0, 2, 0, 3, 0, 0, 0, 4, 'e', 't', 'h', 0, 255, 255, 255, 255},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var big, little inTest
+		UnmarshalBigEndian(data, &big)
+		UnmarshalLittleEndian(data, &little)
+		UnmarshalBigEndianFrom(bytes.NewReader(data), &big)
+	})
+}
+
+func TestUnmarshalBounds(t *testing.T) {
+	type inTest struct {
+		Host  String16      `bin:"min=1,max=4"`
+		Attrs map[byte]byte `bin:"count=8,max=1"`
+		Name  string        `bin:"len=4,min=2"`
+	}
+	for i, caze := range []struct {
+		data  []byte
+		bound string
+		field string
+	}{
+		{[]byte{0, 4, 'h', 'o', 's', 't', 1, 1, 1, 'e', 't', 'h', '0'}, "", ""},
+		{[]byte{0, 0, 0, 'e', 't', 'h', '0'}, "min", "Host"},
+		{[]byte{0, 5, 'h', 'o', 's', 't', 's', 0, 'e', 't', 'h', '0'}, "max", "Host"},
+		{[]byte{0, 1, 'h', 2, 1, 1, 2, 2, 'e', 't', 'h', '0'}, "max", "Attrs"},
+		{[]byte{0, 1, 'h', 0, 'e', 0, 0, 0}, "min", "Name"},
+	} {
+		var (
+			ins   inTest
+			bound *BoundError
+		)
+		if e := UnmarshalBigEndian(caze.data, &ins); caze.bound == "" && e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if caze.bound != "" && (!errors.As(e, &bound) || bound.Bound != caze.bound || bound.Field != caze.field) {
+			t.Errorf("case %d except %s BoundError of %s, but got %v", i, caze.bound, caze.field, e)
+		}
+	}
+}
+
+type orderUnmarshaler uint16
+
+func (ou *orderUnmarshaler) UnmarshalBin(data []byte, order binary.ByteOrder) (used int, err error) {
+	if len(data) < 2 {
+		return 0, fmt.Errorf("Need more %d byte(s)", 2-len(data))
+	}
+	*ou = orderUnmarshaler(order.Uint16(data))
+	return 2, nil
+}
+
+func TestOrderUnmarshaler(t *testing.T) {
+	type inTest struct {
+		A orderUnmarshaler
+		B *orderUnmarshaler
+	}
+	var (
+		big, little inTest
+		b           = orderUnmarshaler(1)
+		except      = inTest{1080, &b}
+	)
+	if e := UnmarshalBigEndian([]byte{4, 56, 0, 1}, &big); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(big, except) {
+		t.Errorf("except %#v, but got %#v", except, big)
+	}
+	if e := UnmarshalLittleEndian([]byte{56, 4, 1, 0}, &little); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(little, except) {
+		t.Errorf("except %#v, but got %#v", except, little)
+	}
+}
+
+type tlv struct {
+	Type  uint8
+	Value []byte
+	Next  *tlv
+}
+
+func (v *tlv) DecodeBin(d *Decoder) (err error) {
+	var length uint16
+	if v.Type, err = d.ReadUint8(); err != nil {
+		return
+	}
+	if length, err = d.ReadUint16(); err != nil {
+		return
+	}
+	if v.Value, err = d.ReadBytes(int(length)); err != nil {
+		return
+	}
+	if v.Type&0x80 != 0 {
+		v.Next = new(tlv)
+		err = d.Decode(v.Next)
+	}
+	return
+}
+
+func TestStreamUnmarshaler(t *testing.T) {
+	type inTest struct {
+		Ver byte
+		TLV tlv
+		ID  uint16
+	}
+	var (
+		big, little inTest
+		except      = inTest{5, tlv{0x81, []byte{7}, &tlv{2, []byte{8, 9}, nil}}, 1080}
+	)
+	if e := UnmarshalBigEndian([]byte{5, 0x81, 0, 1, 7, 2, 0, 2, 8, 9, 4, 56}, &big); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(big, except) {
+		t.Errorf("except %#v, but got %#v", except, big)
+	}
+	if e := UnmarshalLittleEndianFrom(bytes.NewReader([]byte{5, 0x81, 1, 0, 7, 2, 2, 0, 8, 9, 56, 4}), &little); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(little, except) {
+		t.Errorf("except %#v, but got %#v", except, little)
+	}
+
+	for i, bs := range [][]byte{
+		{5, 0x81, 0, 1, 7, 2, 0, 2, 8},
+		{5, 0x81, 0, 1},
+		{5},
+	} {
+		var ins inTest
+		if e := UnmarshalBigEndian(bs, &ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+type items [6]Bytes8
+
+func (its *items) DecodeBin(d *Decoder) error {
+	for i := range its {
+		if err := d.Decode(&its[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStreamUnmarshalerDepth(t *testing.T) {
+	var (
+		outs  items
+		codec = Codec{Limits: Limits{MaxDepth: 4}}
+	)
+	if e := codec.Unmarshal([]byte{1, 'a', 0, 0, 0, 0, 1, 'f'}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if string(outs[0]) != "a" || string(outs[5]) != "f" {
+		t.Errorf("except a and f, but got %v", outs)
+	}
+}
+
+func TestStreamUnmarshalerLargeValue(t *testing.T) {
+	var (
+		ins    Bytes16
+		value  = bytes.Repeat([]byte{117}, 3*defaultBufSize)
+		reader = io.MultiReader(bytes.NewReader([]byte{48, 0}), bytes.NewReader(value))
+	)
+	if e := UnmarshalBigEndianFrom(reader, &ins); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if int(ins.Length) != len(value) || !bytes.Equal(ins.Value, value) {
+		t.Errorf("except %d byte(s), but got %d", len(value), len(ins.Value))
+	}
+
+	var huge Bytes64
+	if e := UnmarshalBigEndian([]byte{0x40, 0, 0, 0, 0, 0, 0, 0, 117}, &huge); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
+
+func TestUnmarshalStandardInterfaces(t *testing.T) {
+	type inTest struct {
+		Ver  byte
+		Addr netip.Addr    `bin:"prefix=8"`
+		Peer *netip.Addr   `bin:"len=4"`
+		Body *bytes.Buffer `bin:"prefix=16"`
+		Name string        `bin:"prefix=8"`
+		Tail bytes.Buffer  `bin:"rest"`
+	}
+	var (
+		ins  inTest
+		data = []byte{5, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 127, 0, 0, 1, 0, 2, 'o', 'k', 3, 'e', 't', 'h', 'e', 'n', 'd'}
+	)
+	if e := UnmarshalBigEndian(data, &ins); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if ins.Ver != 5 || ins.Addr != netip.MustParseAddr("::1") || *ins.Peer != netip.MustParseAddr("127.0.0.1") ||
+		ins.Body.String() != "ok" || ins.Name != "eth" || ins.Tail.String() != "end" {
+		t.Errorf("unexcept result %v", ins)
+	}
+
+	for i, caze := range []interface{}{
+		new(netip.Addr),
+		&struct{ Addr netip.Addr }{},
+		&struct {
+			Addr netip.Addr `bin:"len=3"`
+		}{},
+		&struct {
+			Addrs []netip.Addr `bin:"len=4"`
+		}{Addrs: make([]netip.Addr, 1)},
+		&struct {
+			Addr netip.Addr `bin:"prefix=8"`
+		}{},
+	} {
+		if e := UnmarshalBigEndian([]byte{10, 0, 0, 1}, caze); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+func TestDecodeGeneric(t *testing.T) {
+	type header struct {
+		Ver  byte
+		Size uint16
+	}
+	if h, used, e := Decode[header]([]byte{5, 1, 0, 9}, binary.LittleEndian); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if h != (header{5, 1}) || used != 3 {
+		t.Errorf("except {5 1} 3, but got %v %d", h, used)
+	}
+	if h, used, e := Decode[*header]([]byte{5, 0, 1}, nil); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if *h != (header{5, 1}) || used != 3 {
+		t.Errorf("except {5 1} 3, but got %v %d", h, used)
+	}
+	if bs, used, e := Decode[Bytes8]([]byte{2, 'o', 'k', 0}, nil); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if string(bs) != "ok" || used != 3 {
+		t.Errorf("except ok 3, but got %s %d", bs, used)
+	}
+	if h, used, e := Decode[header]([]byte{5, 1}, nil); e == nil || h != (header{}) || used != 0 {
+		t.Errorf("except error, but got %v %d %v", h, used, e)
+	}
+
+	if s, e := DecodeFrom[string](bytes.NewBufferString("rest"), nil); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if s != "rest" {
+		t.Errorf("except rest, but got %s", s)
+	}
+	if _, e := DecodeFrom[int](bytes.NewBuffer([]byte{1}), nil); e == nil {
+		t.Errorf("except error, but got nil")
+	}
+}
+
+type tiffHeader struct {
+	Order  [2]byte `bin:"order=auto,magic=0x4949:le,0x4d4d:be"`
+	Magic  uint16
+	Offset uint32
+}
+
+type pcapHeader struct {
+	Magic uint32 `bin:"order=auto,magic=0xa1b2c3d4:be,0xd4c3b2a1:le"`
+	Major uint16
+	Minor uint16
+}
+
+func TestUnmarshalMagicOrder(t *testing.T) {
+	type inTest struct {
+		Tiff tiffHeader
+		Pcap pcapHeader
+		Tail uint16
+	}
+	for i, caze := range []struct {
+		data   []byte
+		except inTest
+	}{
+		{
+			[]byte{'I', 'I', 42, 0, 8, 0, 0, 0, 0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 0, 1},
+			inTest{tiffHeader{[2]byte{'I', 'I'}, 42, 8}, pcapHeader{0xd4c3b2a1, 2, 4}, 1},
+		},
+		{
+			[]byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0xa1, 0xb2, 0xc3, 0xd4, 0, 2, 0, 4, 0, 1},
+			inTest{tiffHeader{[2]byte{'M', 'M'}, 42, 8}, pcapHeader{0xa1b2c3d4, 2, 4}, 1},
+		},
+	} {
+		var outs inTest
+		if e := UnmarshalBigEndian(caze.data, &outs); e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if outs != caze.except {
+			t.Errorf("case %d except %v, but got %v", i, caze.except, outs)
+		}
+	}
+
+	var tiff tiffHeader
+	if e := UnmarshalLittleEndian([]byte{'X', 'X', 42, 0, 8, 0, 0, 0}, &tiff); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+
+	for i, caze := range []interface{}{
+		&struct {
+			Magic uint16 `bin:"order=auto"`
+		}{},
+		&struct {
+			Magic uint16 `bin:"magic=0x4949:le"`
+		}{},
+		&struct {
+			Magic uint16 `bin:"order=big,magic=0x4949:le"`
+		}{},
+		&struct {
+			Magic uint16 `bin:"order=auto,magic=0x4949:middle"`
+		}{},
+		&struct {
+			Magic uint8 `bin:"order=auto,magic=0x4949:le"`
+		}{},
+		&struct {
+			Magic int16 `bin:"order=auto,magic=0x4949:le"`
+		}{},
+		&struct {
+			Magic [9]byte `bin:"order=auto,magic=0x4949:le"`
+		}{},
+	} {
+		if e := UnmarshalBigEndian([]byte{0x49, 0x49}, caze); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+func TestUnmarshalDefault(t *testing.T) {
+	type inTest struct {
+		Ver  byte
+		TTL  uint8   `bin:"default=64"`
+		MTU  *uint16 `bin:"default=0x5dc"`
+		Name string  `bin:"prefix=8,default=eth0"`
+	}
+	mtu := uint16(9000)
+	for i, caze := range []struct {
+		data   []byte
+		except inTest
+	}{
+		{[]byte{4, 1, 0x23, 0x28, 2, 'l', 'o'}, inTest{4, 1, &mtu, "lo"}},
+		{[]byte{4, 1, 0x23, 0x28}, inTest{4, 1, &mtu, "eth0"}},
+		{[]byte{4}, inTest{4, 64, new(uint16), "eth0"}},
+	} {
+		var outs inTest
+		if i == 2 {
+			*caze.except.MTU = 1500
+		}
+		if e := UnmarshalBigEndian(caze.data, &outs); e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if !reflect.DeepEqual(outs, caze.except) {
+			t.Errorf("case %d except %v, but got %v", i, caze.except, outs)
+		}
+	}
+
+	var ports struct {
+		A orderUnmarshaler `bin:"default=5"`
+		B orderUnmarshaler `bin:"default=5"`
+	}
+	if e := UnmarshalLittleEndian([]byte{1, 0, 9}, &ports); e == nil || ports.A != 1 {
+		t.Errorf("except 1 and some error, but got %v %v", ports.A, e)
+	}
+	if e := UnmarshalLittleEndianFrom(bytes.NewReader([]byte{1, 0, 9, 0}), &ports); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if ports.A != 1 || ports.B != 9 {
+		t.Errorf("except 1 9, but got %v %v", ports.A, ports.B)
+	}
+	if e := UnmarshalLittleEndian([]byte{1, 0}, &ports); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if ports.A != 1 || ports.B != 5 {
+		t.Errorf("except 1 5, but got %v %v", ports.A, ports.B)
+	}
+
+	for i, caze := range []struct {
+		data []byte
+		ins  interface{}
+	}{
+		{[]byte{4, 1, 0x23}, &inTest{}},
+		{[]byte{}, &struct {
+			Ver byte
+			TTL uint8 `bin:"default=64"`
+		}{}},
+		{[]byte{4}, &struct {
+			Ver byte
+			TTL uint8 `bin:"default=256"`
+		}{}},
+		{[]byte{4}, &struct {
+			Ver byte
+			TTL uint8 `bin:"default=x"`
+		}{}},
+		{[]byte{4}, &struct {
+			Ver  byte
+			Tags []byte `bin:"default=1"`
+		}{}},
+	} {
+		if e := UnmarshalBigEndian(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+type versioned struct {
+	Ver   byte `bin:"version"`
+	Flags byte `bin:"since=2"`
+	Port  uint16
+	Old   byte `bin:"until=1"`
+	Ext   byte `bin:"since=2,until=3"`
+}
+
+func TestUnmarshalVersion(t *testing.T) {
+	for i, caze := range []struct {
+		version int
+		data    []byte
+		except  versioned
+	}{
+		{0, []byte{1, 0, 80, 9}, versioned{1, 0, 80, 9, 0}},
+		{0, []byte{2, 7, 0, 80, 3}, versioned{2, 7, 80, 0, 3}},
+		{0, []byte{4, 7, 0, 80}, versioned{4, 7, 80, 0, 0}},
+		{4, []byte{1, 0, 80, 9}, versioned{1, 0, 80, 9, 0}},
+	} {
+		var (
+			codec = Codec{Version: caze.version}
+			outs  versioned
+		)
+		if e := codec.Unmarshal(caze.data, &outs); e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if outs != caze.except {
+			t.Errorf("case %d except %v, but got %v", i, caze.except, outs)
+		}
+	}
+
+	type message struct {
+		Port uint16
+		Old  byte `bin:"until=1"`
+		Ext  byte `bin:"since=2"`
+	}
+	var outs message
+	if e := (&Codec{Version: 2}).Unmarshal([]byte{0, 80, 3}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if outs != (message{80, 0, 3}) {
+		t.Errorf("except {80 0 3}, but got %v", outs)
+	}
+
+	for i, caze := range []interface{}{
+		&struct {
+			Ver int `bin:"version"`
+		}{},
+		&struct {
+			Ver []byte `bin:"version"`
+		}{},
+		&struct {
+			Ext byte `bin:"since=3,until=2"`
+		}{},
+		&struct {
+			Ext byte `bin:"since=0"`
+		}{},
+	} {
+		if e := UnmarshalBigEndian([]byte{1, 2, 3, 4, 5, 6, 7, 8}, caze); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+type telemetry struct {
+	Flags uint8
+	ID    uint16
+	Temp  *int16       `bin:"present=Flags:0"`
+	Load  *uint8       `bin:"present=Flags:3"`
+	Tags  *[2]byte     `bin:"present=Flags:7"`
+	Ext   *okMarshaler `bin:"-"`
+}
+
+func TestUnmarshalPresent(t *testing.T) {
+	var (
+		temp = int16(-2)
+		load = uint8(9)
+	)
+	for i, caze := range []struct {
+		data   []byte
+		except telemetry
+	}{
+		{[]byte{0x00, 0, 1}, telemetry{0x00, 1, nil, nil, nil, nil}},
+		{[]byte{0x09, 0, 1, 0xff, 0xfe, 9}, telemetry{0x09, 1, &temp, &load, nil, nil}},
+		{[]byte{0x88, 0, 1, 9, 'o', 'k'}, telemetry{0x88, 1, nil, &load, &[2]byte{'o', 'k'}, nil}},
+	} {
+		outs := telemetry{Temp: new(int16)}
+		if e := UnmarshalBigEndian(caze.data, &outs); e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if !reflect.DeepEqual(outs, caze.except) {
+			t.Errorf("case %d except %v, but got %v", i, caze.except, outs)
+		}
+	}
+
+	for i, caze := range []interface{}{
+		&struct {
+			Flags uint8
+			Temp  int16 `bin:"present=Flags:0"`
+		}{},
+		&struct {
+			Temp  *int16 `bin:"present=Flags:0"`
+			Flags uint8
+		}{},
+		&struct {
+			Flags int8
+			Temp  *int16 `bin:"present=Flags:0"`
+		}{},
+		&struct {
+			Flags uint8
+			Temp  *int16 `bin:"present=Flags:8"`
+		}{},
+		&struct {
+			Flags uint8
+			Temp  *int16 `bin:"present=Flags"`
+		}{},
+	} {
+		if e := UnmarshalBigEndian([]byte{0xff, 0xff, 0xff}, caze); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+func TestUnmarshalRestSlice(t *testing.T) {
+	type record struct {
+		Type byte
+		Data Bytes8
+	}
+	type inTest struct {
+		Count   byte
+		Records []record `bin:"rest"`
+	}
+	var (
+		outs   = inTest{Records: []record{{9, nil}, {9, nil}, {9, nil}}}
+		except = inTest{2, []record{{1, Bytes8("a")}, {2, Bytes8{}}}}
+	)
+	if e := UnmarshalBigEndian([]byte{2, 1, 1, 'a', 2, 0}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(outs, except) {
+		t.Errorf("except %v, but got %v", except, outs)
+	}
+
+	var ports struct {
+		Ports []orderUnmarshaler `bin:"rest"`
+	}
+	for i, decode := range []func() error{
+		func() error { return UnmarshalBigEndian([]byte{0, 1, 0, 2}, &ports) },
+		func() error { return UnmarshalBigEndianFrom(bytes.NewReader([]byte{0, 1, 0, 2}), &ports) },
+	} {
+		if e := decode(); e != nil {
+			t.Errorf("case %d unexcept error: %v", i, e)
+		} else if !reflect.DeepEqual(ports.Ports, []orderUnmarshaler{1, 2}) {
+			t.Errorf("case %d except [1 2], but got %v", i, ports.Ports)
+		}
+	}
+
+	var words struct {
+		Ver   byte
+		Words *[]uint16 `bin:"rest"`
+	}
+	if e := UnmarshalLittleEndian([]byte{1, 1, 0, 2, 0}, &words); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(*words.Words, []uint16{1, 2}) {
+		t.Errorf("except [1 2], but got %v", *words.Words)
+	}
+	if e := UnmarshalLittleEndian([]byte{1}, &words); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if len(*words.Words) != 0 {
+		t.Errorf("except [], but got %v", *words.Words)
+	}
+
+	var payload struct {
+		Ver  byte
+		Data []byte `bin:"rest"`
+	}
+	if e := UnmarshalBigEndian([]byte{1, 'o', 'k'}, &payload); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if string(payload.Data) != "ok" {
+		t.Errorf("except ok, but got %v", payload.Data)
+	}
+
+	for i, caze := range []struct {
+		codec Codec
+		data  []byte
+		ins   interface{}
+	}{
+		{Codec{}, []byte{1, 1, 0, 2}, &words},
+		{Codec{}, []byte{2, 1, 1, 'a', 2}, &inTest{}},
+		{Codec{Limits: Limits{MaxElements: 1}}, []byte{1, 1, 0, 2, 0}, &words},
+		{Codec{Limits: Limits{MaxBytes: 2}}, []byte{1, 'o', 'k'}, &payload},
+		{Codec{}, []byte{1, 2}, &struct {
+			Ver   byte
+			Empty []struct{} `bin:"rest"`
+		}{}},
+	} {
+		if e := caze.codec.Unmarshal(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+type option struct {
+	Code byte
+	Data Bytes8
+}
+
+func (opt option) IsTerminator() bool {
+	return opt.Code == 0
+}
+
+type emptyTerm struct{}
+
+func (et emptyTerm) IsTerminator() bool {
+	return false
+}
+
+func TestUnmarshalTerm(t *testing.T) {
+	type inTest struct {
+		Codes   []byte   `bin:"term=0xff"`
+		Options []option `bin:"term"`
+		Words   []uint16 `bin:"term=0,peekterm"`
+		End     uint16
+	}
+	var (
+		outs   = inTest{Codes: []byte{9, 9, 9}}
+		except = inTest{[]byte{1, 2}, []option{{1, Bytes8("a")}}, []uint16{7}, 0}
+	)
+	if e := UnmarshalBigEndian([]byte{1, 2, 0xff, 1, 1, 'a', 0, 0, 0, 7, 0, 0}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(outs, except) {
+		t.Errorf("except %v, but got %v", except, outs)
+	}
+
+	for i, caze := range []struct {
+		data []byte
+		ins  interface{}
+	}{
+		{[]byte{1, 2}, &inTest{}},
+		{[]byte{0xff, 1, 1}, &inTest{}},
+		{[]byte{0xff, 0, 0, 0, 7}, &inTest{}},
+		{[]byte{0}, &struct {
+			Codes []byte `bin:"term=0x100"`
+		}{}},
+		{[]byte{0}, &struct {
+			Codes []byte `bin:"term"`
+		}{}},
+		{[]byte{0}, &struct {
+			Codes []byte `bin:"peekterm"`
+		}{}},
+		{[]byte{0}, &struct {
+			Codes []byte `bin:"term=0,rest"`
+		}{}},
+		{[]byte{0}, &struct {
+			Code byte `bin:"term=0"`
+		}{}},
+		{[]byte{1, 0}, &struct {
+			Empty []emptyTerm `bin:"term"`
+		}{}},
+	} {
+		if e := UnmarshalBigEndian(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+	var peeked struct {
+		Codes []byte `bin:"term=0,peekterm"`
+		End   orderUnmarshaler
+	}
+	if e := UnmarshalBigEndianFrom(bytes.NewReader([]byte{1, 2, 0, 9}), &peeked); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !bytes.Equal(peeked.Codes, []byte{1, 2}) || peeked.End != 9 {
+		t.Errorf("except [1 2] 9, but got %v %v", peeked.Codes, peeked.End)
+	}
+	var (
+		chunked struct {
+			Codes []uint64 `bin:"term=0,peekterm"`
+			End   orderUnmarshaler
+			Rest  []byte `bin:"rest"`
+		}
+		stream = append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, make([]byte, 8+defaultBufSize-7)...)
+	)
+	for i := 16; i < len(stream); i++ {
+		stream[i] = byte(i)
+	}
+	if e := UnmarshalBigEndianFrom(io.MultiReader(bytes.NewReader(stream[:9]), bytes.NewReader(stream[9:])), &chunked); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(chunked.Codes, []uint64{1}) || chunked.End != 0 || !bytes.Equal(chunked.Rest, stream[10:]) {
+		t.Errorf("except %v 0 %v, but got %v %v %v", []uint64{1}, stream[10:], chunked.Codes, chunked.End, chunked.Rest)
+	}
+
+	if e := UnmarshalBigEndian([]byte{0}, &struct {
+		Options []option `bin:"term=0"`
+	}{}); e == nil || e.Error() != "Field Options: term requires a boolean, fixed-size number or string" {
+		t.Errorf("except term error, but got %v", e)
+	}
+}
+
+type extension struct {
+	Kind byte
+	Name string `bin:"rest"`
+}
+
+type windowed struct {
+	Len  uint8
+	Ext  *extension `bin:"window=Len"`
+	Size uint16
+	Body struct {
+		Port uint16
+	} `bin:"window=Size"`
+	Tail byte
+}
+
+func TestUnmarshalWindow(t *testing.T) {
+	var (
+		outs   windowed
+		except windowed
+	)
+	except.Len, except.Ext, except.Size, except.Body.Port, except.Tail = 3, &extension{1, "ok"}, 4, 80, 9
+	if e := UnmarshalBigEndian([]byte{3, 1, 'o', 'k', 0, 4, 0, 80, 0xee, 0xee, 9}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(outs, except) {
+		t.Errorf("except %v, but got %v", except, outs)
+	}
+
+	var payload struct {
+		Len  uint8
+		Body struct {
+			Data []byte `bin:"rest"`
+		} `bin:"window=Len"`
+	}
+	data := append([]byte{60}, bytes.Repeat([]byte{7}, 60)...)
+	if e := (&Codec{Limits: Limits{MaxAlloc: 100}}).Unmarshal(data, &payload); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !bytes.Equal(payload.Body.Data, data[1:]) {
+		t.Errorf("except %v, but got %v", data[1:], payload.Body.Data)
+	}
+
+	for i, caze := range []struct {
+		codec Codec
+		data  []byte
+		ins   interface{}
+	}{
+		{Codec{}, []byte{3, 1, 'o', 'k', 0, 1, 0, 80, 9}, &windowed{}},
+		{Codec{}, []byte{3, 1, 'o'}, &windowed{}},
+		{Codec{Limits: Limits{MaxBytes: 10}}, []byte{3, 1, 'o', 'k', 0, 4, 0, 80, 0xee, 0xee, 9}, &windowed{}},
+		{Codec{}, []byte{1, 1}, &struct {
+			Ext byte `bin:"window=Len"`
+			Len uint8
+		}{}},
+		{Codec{}, []byte{1, 1}, &struct {
+			Len int8
+			Ext byte `bin:"window=Len"`
+		}{}},
+		{Codec{}, []byte{1, 1, 1}, &struct {
+			Len  uint8
+			Ext  byte `bin:"window=Len"`
+			More byte `bin:"window=Len"`
+		}{}},
+	} {
+		if e := caze.codec.Unmarshal(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
+
+type padded struct {
+	Ver  byte
+	_    struct{} `bin:"skip=3,pad=0x20"`
+	Port uint16   `bin:"skip=2"`
+	Tail byte
+}
+
+func TestUnmarshalSkip(t *testing.T) {
+	var outs padded
+	if e := UnmarshalBigEndian([]byte{5, 1, 2, 3, 4, 5, 0, 80, 9}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if outs.Ver != 5 || outs.Port != 80 || outs.Tail != 9 {
+		t.Errorf("except {5 80 9}, but got %v", outs)
+	}
+
+	for i, caze := range []struct {
+		codec Codec
+		data  []byte
+		ins   interface{}
+	}{
+		{Codec{}, []byte{5, 1, 2}, &padded{}},
+		{Codec{}, []byte{5, 1, 2, 3, 4}, &padded{}},
+		{Codec{Limits: Limits{MaxBytes: 4}}, []byte{5, 1, 2, 3, 4, 5, 0, 80, 9}, &padded{}},
+		{Codec{}, []byte{1, 2}, &struct {
+			_ byte `bin:"pad=1"`
+		}{}},
+		{Codec{}, []byte{1, 2}, &struct {
+			Ver byte `bin:"skip=0"`
+		}{}},
+		{Codec{}, []byte{1, 2}, &struct {
+			Ver byte `bin:"skip=1,pad=256"`
+		}{}},
+	} {
+		if e := caze.codec.Unmarshal(caze.data, caze.ins); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package bin
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -18,124 +19,401 @@ type LittleEndianMarshaler interface {
 	MarshalLittleEndian() ([]byte, error)
 }
 
+// Marshaler is the interface implemented by types that can marshal themselves into valid binary data of the given byte order.
+type Marshaler interface {
+	MarshalBin(order binary.ByteOrder) ([]byte, error)
+}
+
+// StreamMarshaler is the interface implemented by types that can encode themselves by writing to an Encoder.
+// StreamMarshaler takes precedence over the other marshaler interfaces.
+type StreamMarshaler interface {
+	EncodeBin(e *Encoder) error
+}
+
 // MarshalBigEndian returns the big-endian encoding binary data of ins.
 //
 // MarshalBigEndian traverses the value ins recursively.
 // If an encountered value implements the BigEndianMarshaler interface,
-// MarshalBigEndian calls its MarshalBigEndian method to produce big-endian binary data.
+// MarshalBigEndian calls its MarshalBigEndian method to produce big-endian binary data,
+// otherwise if it implements the Marshaler interface, MarshalBigEndian calls its MarshalBin method.
 func MarshalBigEndian(ins interface{}) ([]byte, error) {
-	var buffer = new(bytes.Buffer)
-	if err := marshal(buffer, ins, binary.BigEndian, bigEndianMarshalerType, bigEndianMarshaler); err != nil {
-		return []byte{}, err
-	}
-	return buffer.Bytes(), nil
+	return (&Codec{Order: binary.BigEndian}).Marshal(ins)
 }
 
 // MarshalLittleEndian returns the little-endian encoding binary data of ins.
 //
 // MarshalLittleEndian traverses the value ins recursively.
 // If an encountered value implements the LittleEndianMarshaler interface,
-// MarshalLittleEndian calls its MarshalLittleEndian method to produce little-endian binary data.
+// MarshalLittleEndian calls its MarshalLittleEndian method to produce little-endian binary data,
+// otherwise if it implements the Marshaler interface, MarshalLittleEndian calls its MarshalBin method.
 func MarshalLittleEndian(ins interface{}) ([]byte, error) {
-	var buffer = new(bytes.Buffer)
-	if err := marshal(buffer, ins, binary.LittleEndian, littleEndianMarshalerType, littleEndianMarshaler); err != nil {
-		return []byte{}, err
-	}
-	return buffer.Bytes(), nil
+	return (&Codec{Order: binary.LittleEndian}).Marshal(ins)
 }
 
 // MarshalBigEndianTo writes the big-endian encoding binary data of ins into writer.
 //
 // MarshalBigEndianTo traverses the value ins recursively.
 // If an encountered value implements the BigEndianMarshaler interface,
-// MarshalBigEndianTo calls its MarshalBigEndian method to produce big-endian binary data.
+// MarshalBigEndianTo calls its MarshalBigEndian method to produce big-endian binary data,
+// otherwise if it implements the Marshaler interface, MarshalBigEndianTo calls its MarshalBin method.
 func MarshalBigEndianTo(writer io.Writer, ins interface{}) error {
-	return marshal(writer, ins, binary.BigEndian, bigEndianMarshalerType, bigEndianMarshaler)
+	return (&Codec{Order: binary.BigEndian}).MarshalTo(writer, ins)
 }
 
 // MarshalLittleEndianTo writes the little-endian encoding binary data of ins into writer.
 //
 // MarshalLittleEndianTo traverses the value ins recursively.
 // If an encountered value implements the LittleEndianMarshaler interface,
-// MarshalLittleEndianTo calls its MarshalLittleEndian method to produce little-endian binary data.
+// MarshalLittleEndianTo calls its MarshalLittleEndian method to produce little-endian binary data,
+// otherwise if it implements the Marshaler interface, MarshalLittleEndianTo calls its MarshalBin method.
 func MarshalLittleEndianTo(writer io.Writer, ins interface{}) error {
-	return marshal(writer, ins, binary.LittleEndian, littleEndianMarshalerType, littleEndianMarshaler)
+	return (&Codec{Order: binary.LittleEndian}).MarshalTo(writer, ins)
 }
 
 var (
+	binaryMarshalerType       = reflect.TypeOf(new(encoding.BinaryMarshaler)).Elem()
+	writerToType              = reflect.TypeOf(new(io.WriterTo)).Elem()
+	streamMarshalerType       = reflect.TypeOf(new(StreamMarshaler)).Elem()
+	marshalerType             = reflect.TypeOf(new(Marshaler)).Elem()
 	bigEndianMarshalerType    = reflect.TypeOf(new(BigEndianMarshaler)).Elem()
 	littleEndianMarshalerType = reflect.TypeOf(new(LittleEndianMarshaler)).Elem()
 )
 
-type marshalerFunc func(v interface{}) ([]byte, error)
+type marshalerFunc func(v interface{}, order binary.ByteOrder) ([]byte, error)
+
+func bigEndianMarshaler(v interface{}, order binary.ByteOrder) ([]byte, error) {
+	if marshaler, ok := v.(BigEndianMarshaler); ok {
+		return marshaler.MarshalBigEndian()
+	}
+	return v.(Marshaler).MarshalBin(order)
+}
+
+func littleEndianMarshaler(v interface{}, order binary.ByteOrder) ([]byte, error) {
+	if marshaler, ok := v.(LittleEndianMarshaler); ok {
+		return marshaler.MarshalLittleEndian()
+	}
+	return v.(Marshaler).MarshalBin(order)
+}
+
+func binMarshaler(v interface{}, order binary.ByteOrder) ([]byte, error) {
+	return v.(Marshaler).MarshalBin(order)
+}
+
+// Encoder writes binary values to the output of one marshal call.
+// An Encoder is passed to the EncodeBin method of StreamMarshaler implementations.
+type Encoder struct {
+	codec      *Codec
+	writer     io.Writer
+	order      binary.ByteOrder
+	endianType reflect.Type
+	marshaler  marshalerFunc
+	version    int
+	stack      frameStack
+	// windows holds the encoded bytes of the windowed fields whose length field is written.
+	windows map[*field][][]byte
+	// window is the windowed field encoded to compute its length.
+	window *field
+}
+
+// marshalerOf returns the endian-specific marshaler interface of order and the function calling it.
+// The interface is nil for an order which is neither big-endian nor little-endian.
+func marshalerOf(order binary.ByteOrder) (reflect.Type, marshalerFunc) {
+	switch {
+	case order == binary.BigEndian || sameOrder(order, binary.BigEndian):
+		return bigEndianMarshalerType, bigEndianMarshaler
+	case order == binary.LittleEndian || sameOrder(order, binary.LittleEndian):
+		return littleEndianMarshalerType, littleEndianMarshaler
+	}
+	return nil, binMarshaler
+}
+
+func marshal(writer io.Writer, ins interface{}, codec *Codec) error {
+	e := &Encoder{codec: codec, writer: writer, version: codec.Version}
+	e.setOrder(codec.order())
+	return e.encode(frame{value: reflect.ValueOf(ins), field: &rootField})
+}
+
+func (e *Encoder) setOrder(order binary.ByteOrder) {
+	e.order = order
+	e.endianType, e.marshaler = marshalerOf(order)
+}
+
+// Order returns the byte order of the output.
+func (e *Encoder) Order() binary.ByteOrder {
+	return e.order
+}
+
+// Version returns the protocol version of the output, zero if every field is encoded.
+func (e *Encoder) Version() int {
+	return e.version
+}
+
+// WriteUint8 writes an unsigned integer of 8 bits.
+func (e *Encoder) WriteUint8(n uint8) error {
+	return e.writeUint(1, uint64(n))
+}
+
+// WriteUint16 writes an unsigned integer of 16 bits.
+func (e *Encoder) WriteUint16(n uint16) error {
+	return e.writeUint(2, uint64(n))
+}
+
+// WriteUint32 writes an unsigned integer of 32 bits.
+func (e *Encoder) WriteUint32(n uint32) error {
+	return e.writeUint(4, uint64(n))
+}
+
+// WriteUint64 writes an unsigned integer of 64 bits.
+func (e *Encoder) WriteUint64(n uint64) error {
+	return e.writeUint(8, n)
+}
+
+// WriteBytes writes data as is.
+func (e *Encoder) WriteBytes(data []byte) error {
+	_, err := e.writer.Write(data)
+	return err
+}
 
-func bigEndianMarshaler(v interface{}) ([]byte, error) {
-	marshaler := v.(BigEndianMarshaler)
-	return marshaler.MarshalBigEndian()
+// Encode encodes ins into the output, as if it was a nested value of the one being encoded.
+func (e *Encoder) Encode(ins interface{}) error {
+	return e.encode(frame{value: reflect.ValueOf(ins)})
 }
 
-func littleEndianMarshaler(v interface{}) ([]byte, error) {
-	marshaler := v.(LittleEndianMarshaler)
-	return marshaler.MarshalLittleEndian()
+func (e *Encoder) writeUint(size int, n uint64) error {
+	buf := make([]byte, size)
+	encodeUint(buf, e.order, n)
+	return e.WriteBytes(buf)
+}
+
+// writePrefixed writes value prefixed by its length as an unsigned integer of bits wide.
+func (e *Encoder) writePrefixed(name string, declared uint64, value []byte, bits int) error {
+	length, err := prefixLength(name, declared, len(value), maxUint(bits))
+	if err == nil {
+		if err = e.writeUint(bits/8, length); err == nil {
+			err = e.WriteBytes(value)
+		}
+	}
+	return err
+}
+
+// bytesWriterTo is an io.WriterTo holding its unread bytes, such as *bytes.Buffer,
+// which is marshaled from its bytes so that it is not consumed.
+type bytesWriterTo interface {
+	io.WriterTo
+	Bytes() []byte
+}
+
+// isMarshaler reports whether tpe implements a marshaler interface for a value described by f,
+// the standard interfaces only count for a field framed by its tag.
+func (e *Encoder) isMarshaler(tpe reflect.Type, f *field) bool {
+	interfaces := []reflect.Type{streamMarshalerType, e.endianType, marshalerType}
+	if framedByTag(f) {
+		interfaces = append(interfaces, binaryMarshalerType, writerToType)
+	}
+	for _, t := range interfaces {
+		if t != nil && tpe.Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// callMarshaler encodes v with the first marshaler interface it implements,
+// the output of the standard interfaces is framed as described by f.
+func (e *Encoder) callMarshaler(v interface{}, f *field) error {
+	var (
+		tpe  = reflect.TypeOf(v)
+		data []byte
+		err  error
+	)
+	if marshaler, ok := v.(StreamMarshaler); ok {
+		return marshaler.EncodeBin(e)
+	}
+	if (e.endianType != nil && tpe.Implements(e.endianType)) || tpe.Implements(marshalerType) {
+		if data, err = e.marshaler(v, e.order); err == nil {
+			err = e.WriteBytes(data)
+		}
+		return err
+	}
+	switch marshaler := v.(type) {
+	case encoding.BinaryMarshaler:
+		data, err = marshaler.MarshalBinary()
+	case bytesWriterTo:
+		data = marshaler.Bytes()
+	case io.WriterTo:
+		if seeker, ok := v.(io.Seeker); ok {
+			var offset int64
+			if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+			defer seeker.Seek(offset, io.SeekStart)
+		}
+		if f.length == 0 && f.prefix == 0 {
+			_, err = marshaler.WriteTo(e.writer)
+			return err
+		}
+		buffer := new(bytes.Buffer)
+		_, err = marshaler.WriteTo(buffer)
+		data = buffer.Bytes()
+	}
+	if err == nil {
+		err = e.writeFramed(f, tpe.String(), data)
+	}
+	return err
+}
+
+// writeFramed writes data framed as described by f, data is written as is without framing.
+func (e *Encoder) writeFramed(f *field, name string, data []byte) error {
+	switch {
+	case f != nil && f.length > 0 && len(data) != f.length:
+		return &LengthError{name, uint64(f.length), uint64(len(data))}
+	case f != nil && f.prefix > 0:
+		return e.writePrefixed(name, 0, data, f.prefix)
+	}
+	return e.WriteBytes(data)
 }
 
-func marshal(writer io.Writer, ins interface{}, order binary.ByteOrder, marshalerType reflect.Type, marshaler marshalerFunc) error {
+// encode encodes the value of root and everything it pushes onto the stack.
+func (e *Encoder) encode(root frame) error {
 	var (
-		stack valueStack
-		cur   reflect.Value
-		tpe   reflect.Type
-		kind  reflect.Kind
-		err   error
+		top  frame
+		cur  reflect.Value
+		tpe  reflect.Type
+		kind reflect.Kind
+		err  error
+		base = len(e.stack)
 	)
 
-	stack.Push(reflect.ValueOf(ins))
-	for len(stack) > 0 && err == nil {
-		cur = stack.Pop()
+	e.stack.Push(root)
+	for len(e.stack) > base && err == nil {
+		top = e.stack.Pop()
+		if top.action != nil {
+			err = top.action()
+			continue
+		}
+		cur = top.value
 
 		if !cur.IsValid() {
 			err = fmt.Errorf("Unexcepted error")
 			break
 		}
 
+		if top.parent.IsValid() {
+			if top.field.window != "" {
+				if top.field != e.window {
+					err = e.popWindow(top.field)
+					continue
+				}
+				e.window = nil
+			}
+			if !top.field.inVersion(e.version) {
+				continue
+			}
+			if top.field.present != "" && cur.IsNil() {
+				continue
+			}
+			if top.field.skip > 0 {
+				if err = e.WriteBytes(bytes.Repeat([]byte{top.field.pad}, top.field.skip)); err != nil || top.field.blank {
+					continue
+				}
+			}
+			if len(top.field.bits) > 0 {
+				cur = bitmapOf(top.parent, cur, top.field)
+				top.value = cur
+			}
+			if top.field.windowed > 0 {
+				if cur, err = e.windowLength(top); err != nil {
+					break
+				}
+				top.value = cur
+			}
+			if top.field.defValue.IsValid() && e.codec.DefaultPolicy == DefaultOnZero && cur.IsZero() {
+				cur = defaultOf(cur.Type(), top.field)
+				top.value = cur
+			}
+			if top.field.version {
+				e.version = versionOf(cur)
+			}
+			if err = checkBounds(cur, top.field); err != nil {
+				break
+			}
+		}
+
 		tpe = cur.Type()
 		kind = cur.Kind()
-		if tpe.Implements(marshalerType) {
-			if kind == reflect.Ptr && cur.IsNil() {
-				cur = reflect.New(tpe.Elem())
+		if hasValidator(tpe) {
+			if err = validate(top); err != nil {
+				break
 			}
-			if data, e := marshaler(cur.Interface()); e != nil {
-				err = e
-			} else {
-				_, err = writer.Write(data)
+		}
+		if top.field != nil && top.field.auto && kind != reflect.Ptr {
+			err = e.writeMagic(cur, top.field)
+			continue
+		}
+		if encode := e.codec.lookup(tpe).encode; encode != nil {
+			err = encode(e, cur.Interface())
+			continue
+		}
+		if e.isMarshaler(tpe, top.field) {
+			if kind == reflect.Ptr && cur.IsNil() {
+				if cur, err = nilValue(cur, top.field, e.codec.NilPolicy); err != nil || !cur.IsValid() {
+					continue
+				}
 			}
+			err = e.callMarshaler(cur.Interface(), top.field)
 			continue
 		}
 
 		switch kind {
 		case reflect.Ptr:
-			if cur.IsNil() {
-				stack.Push(reflect.New(tpe.Elem()))
-			} else {
-				stack.Push(cur.Elem())
+			if !cur.IsNil() {
+				e.stack.Push(frame{value: cur.Elem(), field: top.field, path: top.path})
+			} else if cur, err = nilValue(cur, top.field, e.codec.NilPolicy); err == nil && cur.IsValid() {
+				e.stack.Push(frame{value: cur, field: top.field, path: top.path})
 			}
 
 		case reflect.Struct:
-			err = handleStructKind(&cur, tpe, &stack)
+			if scoped(tpe, e.codec.tagName()) {
+				e.stack.Push(frame{action: e.restoreScope(e.order, e.version)})
+			}
+			if err = handleStructKind(&cur, tpe, e.codec.tagName(), &e.stack, top.extend(), 0); err == nil && e.codec.NilPolicy == NilOmit {
+				err = checkTrailingNil(cur, tpe, e.codec.tagName())
+			}
 
 		case reflect.Slice, reflect.Array:
+			path := top.extend()
+			if kind == reflect.Slice && top.field != nil && top.field.term {
+				if err = e.pushTerminator(cur, top.field, path); err != nil {
+					break
+				}
+			}
 			for i := cur.Len() - 1; i >= 0; i-- {
-				stack.Push(cur.Index(i))
+				e.stack.Push(frame{value: cur.Index(i), path: path})
+			}
+
+		case reflect.Map:
+			keys := cur.MapKeys()
+			if err = sortMapKeys(keys); err != nil {
+				break
+			}
+			if err = writeCount(e.writer, e.order, countWidth(top.field), len(keys)); err != nil {
+				break
+			}
+			path := top.extend()
+			for i := len(keys) - 1; i >= 0; i-- {
+				e.stack.Push(frame{value: cur.MapIndex(keys[i]), path: path})
+				e.stack.Push(frame{value: keys[i], path: path})
 			}
 
 		case reflect.String:
-			_, err = writer.Write([]byte(cur.String()))
+			err = e.writeString(top.field, cur.String())
 
 		case reflect.Bool,
 			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 			reflect.Float32, reflect.Float64,
 			reflect.Complex64, reflect.Complex128:
-			err = binary.Write(writer, order, cur.Interface())
+			err = binary.Write(e.writer, e.order, cur.Interface())
 
 		default:
 			err = fmt.Errorf("Unsupported kind %s", kind)
@@ -144,3 +422,147 @@ func marshal(writer io.Writer, ins interface{}, order binary.ByteOrder, marshale
 
 	return err
 }
+
+// pushTerminator schedules the terminator of the slice cur after its elements,
+// none of which may be a terminator. A terminator left in the input by peekterm is not written.
+func (e *Encoder) pushTerminator(cur reflect.Value, f *field, path *fieldPath) error {
+	for i := 0; i < cur.Len(); i++ {
+		if isTerminator(cur.Index(i), f) {
+			return fmt.Errorf("Field %s: element %d is a terminator", f.name, i)
+		}
+	}
+	switch {
+	case f.peek:
+	case f.termValue.IsValid():
+		e.stack.Push(frame{value: f.termValue, path: path})
+	default:
+		term := reflect.New(cur.Type().Elem()).Elem()
+		if !isTerminator(term, f) {
+			return fmt.Errorf("Field %s: zero %s is not a terminator", f.name, term.Type())
+		}
+		e.stack.Push(frame{value: term, path: path})
+	}
+	return nil
+}
+
+// windowLength encodes the field bounded by the length field top and returns the length to write.
+// The encoded bytes are written in place of the bounded field.
+func (e *Encoder) windowLength(top frame) (reflect.Value, error) {
+	fields, _ := structFields(top.parent.Type(), e.codec.tagName())
+	f := &fields[top.field.windowed-1]
+	buffer := new(bytes.Buffer)
+	sub := &Encoder{codec: e.codec, writer: buffer, version: e.version, window: f}
+	sub.setOrder(e.order)
+	if err := sub.encode(frame{value: top.parent.Field(f.index), field: f, parent: top.parent, path: top.path}); err != nil {
+		return top.value, err
+	}
+	length := reflect.New(top.value.Type()).Elem()
+	if uint64(buffer.Len()) > maxUint(length.Type().Bits()) {
+		return top.value, fmt.Errorf("Field %s: window length %d overflows %s", f.name, buffer.Len(), top.field.name)
+	}
+	length.SetUint(uint64(buffer.Len()))
+	if e.windows == nil {
+		e.windows = make(map[*field][][]byte)
+	}
+	e.windows[f] = append(e.windows[f], buffer.Bytes())
+	return length, nil
+}
+
+// popWindow writes the encoded bytes of the windowed field f.
+func (e *Encoder) popWindow(f *field) error {
+	pending := e.windows[f]
+	if len(pending) == 0 {
+		return fmt.Errorf("Field %s: window %s is not encoded", f.name, f.window)
+	}
+	e.windows[f] = pending[:len(pending)-1]
+	return e.WriteBytes(pending[len(pending)-1])
+}
+
+// writeMagic writes the magic value of the field cur and switches to the byte order it selects.
+func (e *Encoder) writeMagic(cur reflect.Value, f *field) error {
+	var value uint64
+	if cur.Kind() == reflect.Array {
+		for i := 0; i < cur.Len(); i++ {
+			value = value<<8 | cur.Index(i).Uint()
+		}
+	} else {
+		value = cur.Uint()
+	}
+	order, err := magicOrder(f, value)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, magicWidth(cur.Type()))
+	for i := len(buf) - 1; i >= 0; i, value = i-1, value>>8 {
+		buf[i] = byte(value)
+	}
+	if err = e.WriteBytes(buf); err == nil {
+		e.setOrder(order)
+	}
+	return err
+}
+
+// restoreScope returns an action which switches back to order and version
+// once a struct with a magic or version field is encoded.
+func (e *Encoder) restoreScope(order binary.ByteOrder, version int) func() error {
+	return func() error {
+		e.setOrder(order)
+		e.version = version
+		return nil
+	}
+}
+
+// nilValue returns the value to marshal in place of the nil pointer cur,
+// or an invalid value if nothing should be written for it.
+func nilValue(cur reflect.Value, f *field, policy NilPolicy) (reflect.Value, error) {
+	switch policy {
+	case NilError:
+		if f == nil || f.name == "" {
+			return reflect.Value{}, fmt.Errorf("Nil pointer %s", cur.Type())
+		}
+		return reflect.Value{}, fmt.Errorf("Field %s: nil pointer %s", f.name, cur.Type())
+	case NilOmit:
+		if f == nil {
+			return reflect.Value{}, fmt.Errorf("Nil pointer %s is not a field and cannot be omitted", cur.Type())
+		}
+		return reflect.Value{}, nil
+	}
+	return reflect.New(cur.Type().Elem()), nil
+}
+
+// checkTrailingNil reports an error if an absent nil pointer field of cur
+// is followed by a present field.
+func checkTrailingNil(cur reflect.Value, tpe reflect.Type, tagName string) error {
+	fields, _ := structFields(tpe, tagName)
+	absent := ""
+	for _, f := range fields {
+		value := cur.Field(f.index)
+		switch {
+		case f.present != "":
+		case value.Kind() == reflect.Ptr && value.IsNil():
+			if absent == "" {
+				absent = f.name
+			}
+		case absent != "":
+			return fmt.Errorf("Field %s: nil pointer is followed by field %s", absent, f.name)
+		}
+	}
+	return nil
+}
+
+// writeString writes a string framed as described by f.
+// A fixed length string is padded with NUL bytes.
+func (e *Encoder) writeString(f *field, s string) error {
+	switch {
+	case f != nil && f.length > 0:
+		if len(s) > f.length {
+			return fmt.Errorf("String length %d exceeds len=%d", len(s), f.length)
+		}
+		buf := make([]byte, f.length)
+		copy(buf, s)
+		return e.WriteBytes(buf)
+	case f != nil && (f.rest || f.prefix > 0 || f.window != ""):
+		return e.writeFramed(f, "string", []byte(s))
+	}
+	return fmt.Errorf("String requires a len, prefix, rest or window tag")
+}
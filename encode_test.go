@@ -2,7 +2,12 @@ package bin
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
+	"strings"
 	"testing"
 )
 
@@ -60,6 +65,47 @@ func TestUnsupportedMarshalTypes(t *testing.T) {
 	}
 }
 
+func TestMarshalString(t *testing.T) {
+	for i, caze := range []struct {
+		ins    interface{}
+		except []byte
+		err    bool
+	}{
+		{struct {
+			Name string `bin:"len=6"`
+			Ver  byte
+		}{"eth0", 4}, []byte{101, 116, 104, 48, 0, 0, 4}, false},
+		{struct {
+			Ver   byte
+			Extra *string `bin:"rest"`
+		}{4, new(string)}, []byte{4}, false},
+		{struct {
+			Name string `bin:"len=2"`
+		}{"eth0"}, []byte{}, true},
+		{struct {
+			Name string
+		}{"eth0"}, []byte{}, true},
+		{struct {
+			Name string `bin:"len=2,rest"`
+		}{"eth0"}, []byte{}, true},
+		{struct {
+			Data []byte `bin:"len=4"`
+		}{[]byte{1, 2}}, []byte{}, true},
+		{struct {
+			Data []byte `bin:"prefix=8"`
+		}{[]byte{1, 2, 3}}, []byte{}, true},
+		{[]string{"eth0"}, []byte{}, true},
+	} {
+		if bs, e := MarshalBigEndian(caze.ins); !caze.err && e != nil {
+			t.Errorf("case %d unexcepted error %v", i, e)
+		} else if caze.err && e == nil {
+			t.Errorf("case %d excepted some error but got nil", i)
+		} else if !caze.err && !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+}
+
 func TestMarshalTags(t *testing.T) {
 	for i, caze := range []struct {
 		ins    interface{}
@@ -231,3 +277,418 @@ func TestMarshalTo(t *testing.T) {
 		t.Errorf("except %v, but got %v,", exceptLittle, bs)
 	}
 }
+
+func TestMarshalMap(t *testing.T) {
+	type key struct {
+		Hi, Lo uint8
+	}
+	for i, caze := range []struct {
+		ins    interface{}
+		except []byte
+	}{
+		{map[uint16]uint32{}, []byte{0, 0, 0, 0}},
+		{map[uint16]uint32{4: 100, 2: 65535}, []byte{0, 0, 0, 2, 0, 2, 0, 0, 255, 255, 0, 4, 0, 0, 0, 100}},
+		{map[key]byte{{1, 2}: 3, {0, 9}: 4}, []byte{0, 0, 0, 2, 0, 9, 4, 1, 2, 3}},
+		{map[int8]String8{-1: "b", 1: "a"}, []byte{0, 0, 0, 2, 255, 1, 98, 1, 1, 97}},
+		{struct {
+			Settings map[uint16]uint32 `bin:"count=8"`
+		}{map[uint16]uint32{3: 100, 1: 4096}}, []byte{2, 0, 1, 0, 0, 16, 0, 0, 3, 0, 0, 0, 100}},
+		{struct {
+			Settings map[uint8]uint8 `bin:"0,count=16"`
+		}{map[uint8]uint8{7: 1}}, []byte{0, 1, 7, 1}},
+	} {
+		if bs, e := MarshalBigEndian(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+}
+
+func TestMarshalMapError(t *testing.T) {
+	large := make(map[uint16]byte)
+	for i := 0; i < 256; i++ {
+		large[uint16(i)] = byte(i)
+	}
+	for i, caze := range []interface{}{
+		map[*byte]byte{new(byte): 1, new(byte): 2},
+		struct {
+			M map[uint16]byte `bin:"count=8"`
+		}{large},
+		struct {
+			M map[uint16]byte `bin:"count=12"`
+		}{},
+		struct {
+			X uint8 `bin:"count=8"`
+		}{},
+	} {
+		if _, e := MarshalBigEndian(caze); e == nil {
+			t.Errorf("case %d excepted some error but got nil", i)
+		}
+	}
+}
+
+func TestMarshalBounds(t *testing.T) {
+	type inTest struct {
+		Host    String16 `bin:"min=1,max=4"`
+		Methods Bytes8   `bin:"max=2"`
+		Name    *string  `bin:"len=8,min=2"`
+	}
+	name := "eth0"
+	for i, caze := range []struct {
+		ins   inTest
+		bound string
+	}{
+		{inTest{String16{Value: "host"}, Bytes8{0, 2}, &name}, ""},
+		{inTest{String16{Value: "host"}, Bytes8{0}, nil}, ""},
+		{inTest{String16{}, Bytes8{0}, &name}, "min"},
+		{inTest{String16{Value: "hosts"}, Bytes8{0}, &name}, "max"},
+		{inTest{String16{Value: "h"}, Bytes8{0, 1, 2}, &name}, "max"},
+	} {
+		var bound *BoundError
+		if _, e := MarshalBigEndian(caze.ins); caze.bound == "" && e != nil {
+			t.Errorf("case %d unexcepted error %v", i, e)
+		} else if caze.bound != "" && (!errors.As(e, &bound) || bound.Bound != caze.bound) {
+			t.Errorf("case %d excepted %s BoundError but got %v", i, caze.bound, e)
+		}
+	}
+
+	if _, e := MarshalBigEndian(struct {
+		Port uint16 `bin:"max=2"`
+	}{}); e == nil {
+		t.Errorf("excepted some error but got nil")
+	}
+}
+
+type orderMarshaler uint16
+
+func (om orderMarshaler) MarshalBin(order binary.ByteOrder) ([]byte, error) {
+	bs := make([]byte, 2)
+	order.PutUint16(bs, uint16(om))
+	return bs, nil
+}
+
+type bothMarshaler struct{ okMarshaler }
+
+func (bm bothMarshaler) MarshalBin(order binary.ByteOrder) ([]byte, error) {
+	return []byte("bin"), nil
+}
+
+func TestOrderMarshaler(t *testing.T) {
+	for i, caze := range []struct {
+		ins    interface{}
+		big    []byte
+		little []byte
+	}{
+		{orderMarshaler(1080), []byte{4, 56}, []byte{56, 4}},
+		{struct{ P *orderMarshaler }{}, []byte{0, 0}, []byte{0, 0}},
+		{bothMarshaler{}, []byte("ok"), []byte("ko")},
+	} {
+		if bs, e := MarshalBigEndian(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.big) {
+			t.Errorf("case %d except %v but got %v", i, caze.big, bs)
+		}
+		if bs, e := MarshalLittleEndian(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.little) {
+			t.Errorf("case %d except %v but got %v", i, caze.little, bs)
+		}
+	}
+}
+
+func (v tlv) EncodeBin(e *Encoder) (err error) {
+	if err = e.WriteUint8(v.Type); err != nil {
+		return
+	}
+	if err = e.WriteUint16(uint16(len(v.Value))); err != nil {
+		return
+	}
+	if err = e.WriteBytes(v.Value); err != nil {
+		return
+	}
+	if v.Next != nil {
+		err = e.Encode(v.Next)
+	}
+	return
+}
+
+type wideMarshaler struct{}
+
+func (wideMarshaler) EncodeBin(e *Encoder) (err error) {
+	if err = e.WriteUint32(1); err == nil {
+		err = e.WriteUint64(2)
+	}
+	return
+}
+
+func TestStreamMarshaler(t *testing.T) {
+	type inTest struct {
+		Ver  byte
+		TLV  tlv
+		Wide *wideMarshaler
+	}
+	ins := inTest{5, tlv{0x81, []byte{7}, &tlv{2, []byte{8, 9}, nil}}, nil}
+	if bs, e := MarshalBigEndian(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if except := []byte{5, 0x81, 0, 1, 7, 2, 0, 2, 8, 9, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}; !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if bs, e := MarshalLittleEndian(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if except := []byte{5, 0x81, 1, 0, 7, 2, 2, 0, 8, 9, 1, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}; !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if _, e := (&Codec{NilPolicy: NilError}).Marshal(ins); e == nil {
+		t.Errorf("except error but got nil")
+	}
+}
+
+type pkt struct {
+	Ver  uint8
+	Port uint16
+}
+
+func (p pkt) WriteTo(w io.Writer) (int64, error) {
+	return 0, MarshalBigEndianTo(w, p)
+}
+
+func (p *pkt) ReadFrom(r io.Reader) (int64, error) {
+	return 0, UnmarshalBigEndianFrom(r, p)
+}
+
+func TestStandardInterfacesOptIn(t *testing.T) {
+	type inTest struct {
+		Pkt  pkt
+		Tail uint8
+	}
+	var outs inTest
+	if bs, e := MarshalBigEndian(pkt{1, 80}); e != nil || !bytes.Equal(bs, []byte{1, 0, 80}) {
+		t.Errorf("except %v but got %v %v", []byte{1, 0, 80}, bs, e)
+	}
+	if bs, e := MarshalBigEndian(inTest{pkt{1, 80}, 9}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{1, 0, 80, 9}) {
+		t.Errorf("except %v but got %v", []byte{1, 0, 80, 9}, bs)
+	} else if e = UnmarshalBigEndian(bs, &outs); e != nil || outs != (inTest{pkt{1, 80}, 9}) {
+		t.Errorf("except %v, but got %v %v", inTest{pkt{1, 80}, 9}, outs, e)
+	}
+}
+
+func TestMarshalStandardInterfaces(t *testing.T) {
+	type inTest struct {
+		Ver  byte
+		Addr netip.Addr    `bin:"prefix=8"`
+		Peer netip.Addr    `bin:"len=4"`
+		Body *bytes.Buffer `bin:"prefix=16"`
+		Tail *bytes.Buffer `bin:"rest"`
+	}
+	ins := inTest{
+		Ver:  5,
+		Addr: netip.MustParseAddr("::1"),
+		Peer: netip.MustParseAddr("127.0.0.1"),
+		Body: bytes.NewBufferString("ok"),
+		Tail: bytes.NewBufferString("end"),
+	}
+	except := []byte{5, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 127, 0, 0, 1, 0, 2, 'o', 'k', 'e', 'n', 'd'}
+	if bs, e := MarshalBigEndian(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if size, e := (&Codec{}).Size(ins); e != nil || size != len(except) {
+		t.Errorf("except %d but got %d %v", len(except), size, e)
+	} else if bs, e := MarshalBigEndian(ins); e != nil || !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v %v", except, bs, e)
+	}
+
+	name := struct {
+		Name *strings.Reader `bin:"prefix=8"`
+	}{strings.NewReader("eth0")}
+	name.Name.ReadByte()
+	for i := 0; i < 2; i++ {
+		if bs, e := MarshalBigEndian(name); e != nil || !bytes.Equal(bs, []byte{3, 't', 'h', '0'}) {
+			t.Errorf("except %v but got %v %v", []byte{3, 't', 'h', '0'}, bs, e)
+		}
+	}
+
+	if _, e := MarshalBigEndian(netip.MustParseAddr("10.0.0.1")); e == nil {
+		t.Errorf("except error but got nil")
+	}
+
+	var mismatch *LengthError
+	if _, e := MarshalBigEndian(struct {
+		Peer netip.Addr `bin:"len=4"`
+	}{netip.MustParseAddr("::1")}); !errors.As(e, &mismatch) {
+		t.Errorf("except LengthError but got %v", e)
+	}
+	if _, e := MarshalBigEndian(struct {
+		Peer netip.Addr `bin:"len=4,prefix=8"`
+	}{}); e == nil {
+		t.Errorf("except error but got nil")
+	}
+	type untagged struct {
+		Ver  uint8
+		Addr netip.Addr
+		X    uint8
+	}
+	if _, e := MarshalBigEndian(untagged{1, netip.MustParseAddr("1.2.3.4"), 9}); e == nil {
+		t.Errorf("except error but got nil")
+	}
+	if e := UnmarshalBigEndian([]byte{1, 1, 2, 3, 4, 9}, &untagged{}); e == nil {
+		t.Errorf("except error but got nil")
+	}
+}
+
+func TestMarshalMagicOrder(t *testing.T) {
+	type inTest struct {
+		Tiff *tiffHeader
+		Pcap pcapHeader
+		Tail uint16
+	}
+	for i, caze := range []struct {
+		ins    inTest
+		except []byte
+	}{
+		{
+			inTest{&tiffHeader{[2]byte{'I', 'I'}, 42, 8}, pcapHeader{0xa1b2c3d4, 2, 4}, 1},
+			[]byte{'I', 'I', 42, 0, 8, 0, 0, 0, 0xa1, 0xb2, 0xc3, 0xd4, 0, 2, 0, 4, 1, 0},
+		},
+		{
+			inTest{&tiffHeader{[2]byte{'M', 'M'}, 42, 8}, pcapHeader{0xd4c3b2a1, 2, 4}, 1},
+			[]byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 1, 0},
+		},
+	} {
+		if bs, e := MarshalLittleEndian(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+	if _, e := MarshalBigEndian(pcapHeader{Magic: 1}); e == nil {
+		t.Errorf("except error but got nil")
+	}
+}
+
+func TestMarshalVersion(t *testing.T) {
+	type inTest struct {
+		Header versioned
+		Tail   byte `bin:"since=2"`
+	}
+	for i, caze := range []struct {
+		version int
+		ins     interface{}
+		except  []byte
+	}{
+		{0, versioned{1, 7, 80, 9, 3}, []byte{1, 0, 80, 9}},
+		{0, versioned{3, 7, 80, 9, 3}, []byte{3, 7, 0, 80, 3}},
+		{2, versioned{1, 7, 80, 9, 3}, []byte{1, 0, 80, 9}},
+		{1, inTest{versioned{2, 7, 80, 9, 3}, 1}, []byte{2, 7, 0, 80, 3}},
+		{2, inTest{versioned{1, 7, 80, 9, 3}, 1}, []byte{1, 0, 80, 9, 1}},
+	} {
+		codec := Codec{Version: caze.version}
+		if bs, e := codec.Marshal(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+}
+
+func TestMarshalPresent(t *testing.T) {
+	var (
+		temp = int16(-2)
+		load = uint8(9)
+	)
+	for i, caze := range []struct {
+		policy NilPolicy
+		ins    telemetry
+		except []byte
+	}{
+		{NilZero, telemetry{0xff, 1, nil, nil, nil, nil}, []byte{0x76, 0, 1}},
+		{NilError, telemetry{0x00, 1, &temp, &load, nil, nil}, []byte{0x09, 0, 1, 0xff, 0xfe, 9}},
+		{NilOmit, telemetry{0x00, 1, nil, &load, &[2]byte{'o', 'k'}, nil}, []byte{0x88, 0, 1, 9, 'o', 'k'}},
+	} {
+		codec := Codec{NilPolicy: caze.policy}
+		if bs, e := codec.Marshal(caze.ins); e != nil {
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+}
+
+type nonzeroTerm struct{ Code byte }
+
+func (nt nonzeroTerm) IsTerminator() bool {
+	return nt.Code == 0xff
+}
+
+func TestMarshalTerm(t *testing.T) {
+	type inTest struct {
+		Codes   []byte   `bin:"term=0xff"`
+		Options []option `bin:"term"`
+		Words   []uint16 `bin:"term=0,peekterm"`
+		End     uint16
+	}
+	except := []byte{1, 2, 0xff, 1, 1, 'a', 0, 0, 0, 7, 0, 0}
+	if bs, e := MarshalBigEndian(inTest{[]byte{1, 2}, []option{{1, Bytes8("a")}}, []uint16{7}, 0}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+
+	for i, caze := range []interface{}{
+		inTest{Codes: []byte{1, 0xff}},
+		inTest{Options: []option{{0, nil}}},
+		struct {
+			Codes []nonzeroTerm `bin:"term"`
+		}{},
+	} {
+		if _, e := MarshalBigEndian(caze); e == nil {
+			t.Errorf("case %d except error but got nil", i)
+		}
+	}
+}
+
+func TestMarshalWindow(t *testing.T) {
+	var ins windowed
+	ins.Len, ins.Ext, ins.Size, ins.Body.Port, ins.Tail = 0, &extension{1, "ok"}, 9, 80, 9
+	except := []byte{3, 1, 'o', 'k', 0, 2, 0, 80, 9}
+	if bs, e := MarshalBigEndian(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if size, e := (&Codec{}).Size(ins); e != nil || size != len(except) {
+		t.Errorf("except %d but got %d %v", len(except), size, e)
+	}
+
+	ins.Ext.Name = string(make([]byte, 255))
+	if _, e := MarshalBigEndian(ins); e == nil {
+		t.Errorf("except error but got nil")
+	}
+
+	type named struct {
+		Len  uint8
+		Name string `bin:"window=Len"`
+		Tail byte
+	}
+	var outs named
+	if bs, e := MarshalBigEndian(named{Name: "eth0", Tail: 9}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{4, 'e', 't', 'h', '0', 9}) {
+		t.Errorf("except %v but got %v", []byte{4, 'e', 't', 'h', '0', 9}, bs)
+	} else if e = UnmarshalBigEndian(bs, &outs); e != nil || outs != (named{4, "eth0", 9}) {
+		t.Errorf("except %v, but got %v %v", named{4, "eth0", 9}, outs, e)
+	}
+}
+
+func TestMarshalSkip(t *testing.T) {
+	except := []byte{5, 0x20, 0x20, 0x20, 0, 0, 0, 80, 9}
+	if bs, e := MarshalBigEndian(padded{Ver: 5, Port: 80, Tail: 9}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+}
@@ -0,0 +1,74 @@
+package bin
+
+import "encoding/binary"
+
+// PDPEndian is the middle-endian byte order of the PDP-11.
+// A 16-bit word is little-endian and wider integers store their most significant word first.
+var PDPEndian pdpEndian
+
+type pdpEndian struct{}
+
+func (pdpEndian) Uint16(b []byte) uint16 {
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (pdpEndian) PutUint16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+}
+
+func (pdpEndian) AppendUint16(b []byte, v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(b, v)
+}
+
+func (e pdpEndian) Uint32(b []byte) uint32 {
+	_ = b[3] // bounds check hint to compiler
+	return uint32(e.Uint16(b[0:2]))<<16 | uint32(e.Uint16(b[2:4]))
+}
+
+func (e pdpEndian) PutUint32(b []byte, v uint32) {
+	_ = b[3] // early bounds check to guarantee safety of writes below
+	e.PutUint16(b[0:2], uint16(v>>16))
+	e.PutUint16(b[2:4], uint16(v))
+}
+
+func (e pdpEndian) AppendUint32(b []byte, v uint32) []byte {
+	return e.AppendUint16(e.AppendUint16(b, uint16(v>>16)), uint16(v))
+}
+
+func (e pdpEndian) Uint64(b []byte) uint64 {
+	_ = b[7] // bounds check hint to compiler
+	return uint64(e.Uint32(b[0:4]))<<32 | uint64(e.Uint32(b[4:8]))
+}
+
+func (e pdpEndian) PutUint64(b []byte, v uint64) {
+	_ = b[7] // early bounds check to guarantee safety of writes below
+	e.PutUint32(b[0:4], uint32(v>>32))
+	e.PutUint32(b[4:8], uint32(v))
+}
+
+func (e pdpEndian) AppendUint64(b []byte, v uint64) []byte {
+	return e.AppendUint32(e.AppendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func (pdpEndian) String() string {
+	return "PDPEndian"
+}
+
+func (pdpEndian) GoString() string {
+	return "bin.PDPEndian"
+}
+
+// sameOrder reports whether a and b encode unsigned integers of every width identically,
+// so binary.NativeEndian is the same order as binary.BigEndian or binary.LittleEndian.
+func sameOrder(a, b binary.ByteOrder) bool {
+	var x, y [14]byte
+	for _, buf := range []struct {
+		order binary.ByteOrder
+		data  []byte
+	}{{a, x[:]}, {b, y[:]}} {
+		buf.order.PutUint16(buf.data[0:2], 0x0102)
+		buf.order.PutUint32(buf.data[2:6], 0x01020304)
+		buf.order.PutUint64(buf.data[6:14], 0x0102030405060708)
+	}
+	return x == y
+}
@@ -0,0 +1,88 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestPDPEndian(t *testing.T) {
+	var (
+		buf    = make([]byte, 14)
+		except = []byte{2, 1, 2, 1, 4, 3, 2, 1, 4, 3, 6, 5, 8, 7}
+	)
+	PDPEndian.PutUint16(buf[0:2], 0x0102)
+	PDPEndian.PutUint32(buf[2:6], 0x01020304)
+	PDPEndian.PutUint64(buf[6:14], 0x0102030405060708)
+	if !bytes.Equal(buf, except) {
+		t.Errorf("except %v but got %v", except, buf)
+	}
+	if bs := PDPEndian.AppendUint64(PDPEndian.AppendUint32(PDPEndian.AppendUint16(nil, 0x0102), 0x01020304), 0x0102030405060708); !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if n := PDPEndian.Uint16(except[0:2]); n != 0x0102 {
+		t.Errorf("except %x but got %x", 0x0102, n)
+	}
+	if n := PDPEndian.Uint32(except[2:6]); n != 0x01020304 {
+		t.Errorf("except %x but got %x", 0x01020304, n)
+	}
+	if n := PDPEndian.Uint64(except[6:14]); n != 0x0102030405060708 {
+		t.Errorf("except %x but got %x", 0x0102030405060708, n)
+	}
+}
+
+func TestCodecOrders(t *testing.T) {
+	type inTest struct {
+		A uint32
+		B orderMarshaler
+		C okMarshaler
+		D bothMarshaler
+	}
+	native := []byte{0, 0, 0, 1, 0, 2, 'o', 'k', 'o', 'k'}
+	if sameOrder(binary.NativeEndian, binary.LittleEndian) {
+		native = []byte{1, 0, 0, 0, 2, 0, 'k', 'o', 'k', 'o'}
+	}
+	for i, caze := range []struct {
+		order  binary.ByteOrder
+		ins    interface{}
+		except []byte
+		err    bool
+	}{
+		{binary.NativeEndian, inTest{1, 2, okMarshaler{}, bothMarshaler{}}, native, false},
+		{PDPEndian, struct {
+			A uint32
+			B orderMarshaler
+			D bothMarshaler
+		}{1, 2, bothMarshaler{}}, []byte{0, 0, 1, 0, 2, 0, 'b', 'i', 'n'}, false},
+		{PDPEndian, okMarshaler{}, []byte{}, false},
+		{PDPEndian, struct{ A int }{}, nil, true},
+	} {
+		codec := Codec{Order: caze.order}
+		bs, e := codec.Marshal(caze.ins)
+		switch {
+		case caze.err && e == nil:
+			t.Errorf("case %d except error but got nil", i)
+		case !caze.err && e != nil:
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		case !bytes.Equal(bs, caze.except) && !caze.err:
+			t.Errorf("case %d except %v but got %v", i, caze.except, bs)
+		}
+	}
+
+	var (
+		codec = Codec{Order: PDPEndian}
+		outs  struct {
+			A uint32
+			B orderUnmarshaler
+			C uint64
+		}
+	)
+	if e := codec.Unmarshal([]byte{0, 0, 1, 0, 2, 0, 0, 0, 0, 0, 0, 0, 3, 0}, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if outs.A != 1 || outs.B != 2 || outs.C != 3 {
+		t.Errorf("except {1 2 3}, but got %v", outs)
+	}
+	if h, used, e := Decode[struct{ A, B uint16 }]([]byte{1, 0, 2, 0}, PDPEndian); e != nil || h.A != 1 || h.B != 2 || used != 4 {
+		t.Errorf("except {1 2} 4, but got %v %d %v", h, used, e)
+	}
+}
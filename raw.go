@@ -0,0 +1,44 @@
+package bin
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Raw holds the original bytes of a field, which names the Raw field with its raw tag option.
+// A Raw field is neither marshaled nor unmarshaled itself, like a field tagged "-".
+type Raw []byte
+
+// RawMessage is a raw encoded binary value.
+// It implements encoding.BinaryMarshaler and encoding.BinaryUnmarshaler,
+// so a field framed by a len, prefix, rest or window tag can delay its decoding or use a precomputed encoding.
+type RawMessage []byte
+
+// MarshalBinary returns m as the encoding of m.
+func (m RawMessage) MarshalBinary() ([]byte, error) {
+	if m == nil {
+		return []byte{}, nil
+	}
+	return m, nil
+}
+
+// UnmarshalBinary sets *m to a copy of data.
+func (m *RawMessage) UnmarshalBinary(data []byte) error {
+	if m == nil {
+		return fmt.Errorf("RawMessage: UnmarshalBinary on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+var rawType = reflect.TypeOf(Raw(nil))
+
+// bindRaw binds the field f to the Raw field holding its original bytes.
+func bindRaw(tpe reflect.Type, f *field) error {
+	sf, ok := tpe.FieldByName(f.raw)
+	if !ok || len(sf.Index) != 1 || sf.Type != rawType {
+		return fmt.Errorf("Field %s: raw %s is not a Raw field", f.name, f.raw)
+	}
+	f.rawIndex = sf.Index[0]
+	return nil
+}
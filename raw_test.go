@@ -0,0 +1,99 @@
+package bin
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	type header struct {
+		Ver  byte
+		Name Bytes8
+		Port orderUnmarshaler
+	}
+	type signed struct {
+		Header    header `bin:"raw=HeaderRaw"`
+		Len       uint8
+		Ext       extension `bin:"window=Len,raw=ExtRaw"`
+		Sig       [2]byte
+		HeaderRaw Raw
+		ExtRaw    Raw
+	}
+	var (
+		data = []byte{5, 2, 'o', 'k', 0, 80, 4, 1, 'a', 'b', 'c', 0xaa, 0xbb}
+		outs signed
+	)
+	if e := UnmarshalBigEndian(data, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !bytes.Equal(outs.HeaderRaw, data[0:6]) || !bytes.Equal(outs.ExtRaw, data[7:11]) {
+		t.Errorf("except %v %v, but got %v %v", data[0:6], data[7:11], outs.HeaderRaw, outs.ExtRaw)
+	} else if outs.Header.Port != 80 || outs.Ext.Name != "abc" || outs.Sig != [2]byte{0xaa, 0xbb} {
+		t.Errorf("unexcept result %v", outs)
+	}
+
+	if bs, e := MarshalBigEndian(outs); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, data) {
+		t.Errorf("except %v but got %v", data, bs)
+	}
+
+	for i, caze := range []interface{}{
+		&struct {
+			Header header `bin:"raw=Missing"`
+		}{},
+		&struct {
+			Header header `bin:"raw=Other"`
+			Other  []byte `bin:"-"`
+		}{},
+	} {
+		if e := UnmarshalBigEndian(data, caze); e == nil {
+			t.Errorf("case %d except some error, but got nil", i)
+		}
+	}
+	if e := (&Codec{Limits: Limits{MaxAlloc: 8}}).Unmarshal(data, &outs); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
+
+func TestRawMessage(t *testing.T) {
+	type envelope struct {
+		Type    byte
+		Len     uint16
+		Payload RawMessage `bin:"window=Len"`
+		Extra   RawMessage `bin:"prefix=8"`
+		Tail    RawMessage `bin:"rest"`
+	}
+	var (
+		data = []byte{1, 0, 3, 'a', 'b', 'c', 1, 'x', 'y', 'z'}
+		outs envelope
+	)
+	if e := UnmarshalBigEndian(data, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(outs, envelope{1, 3, RawMessage("abc"), RawMessage("x"), RawMessage("yz")}) {
+		t.Errorf("unexcept result %v", outs)
+	}
+
+	if bs, e := MarshalBigEndian(outs); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, data) {
+		t.Errorf("except %v but got %v", data, bs)
+	}
+
+	var name struct {
+		Ver  byte
+		Name string `bin:"rest"`
+	}
+	if e := UnmarshalBigEndian(outs.Tail, &name); e != nil || name.Ver != 'y' || name.Name != "z" {
+		t.Errorf("unexcept result %v %v", name, e)
+	}
+
+	if bs, e := MarshalBigEndian(envelope{}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{0, 0, 0, 0}) {
+		t.Errorf("except %v but got %v", []byte{0, 0, 0, 0}, bs)
+	}
+	if e := (*RawMessage)(nil).UnmarshalBinary(nil); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
@@ -0,0 +1,72 @@
+package bin
+
+import (
+	"reflect"
+	"sync"
+)
+
+// EncodeFunc encodes v, a value of the registered type, by writing to e.
+type EncodeFunc func(e *Encoder, v interface{}) error
+
+// DecodeFunc decodes the value pointed to by v, a pointer to the registered type, by reading from d.
+type DecodeFunc func(d *Decoder, v interface{}) error
+
+// Registry maps types to the functions which encode and decode them.
+// Registered types take precedence over the marshaler interfaces and the kind of the type,
+// so a Registry gives an encoding to types which cannot be given methods.
+//
+// The zero value of Registry is empty and ready to use, a Registry is safe for concurrent use.
+type Registry struct {
+	codecs sync.Map
+}
+
+type registered struct {
+	encode EncodeFunc
+	decode DecodeFunc
+}
+
+// defaultRegistry is consulted by every Codec after its own Registry.
+var defaultRegistry = new(Registry)
+
+// Register registers the functions which encode and decode values of type tpe,
+// replacing any previous registration of tpe.
+// A nil function leaves its direction to the default handling of tpe.
+func (registry *Registry) Register(tpe reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	registry.codecs.Store(tpe, registered{encode, decode})
+}
+
+func (registry *Registry) lookup(tpe reflect.Type) registered {
+	if entry, ok := registry.codecs.Load(tpe); ok {
+		return entry.(registered)
+	}
+	return registered{}
+}
+
+// RegisterCodec registers the functions which encode and decode values of type tpe
+// in the default registry, which is consulted by every Codec and by the top-level functions.
+func RegisterCodec(tpe reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	defaultRegistry.Register(tpe, encode, decode)
+}
+
+// Register registers typed functions which encode and decode values of type T in registry,
+// or in the default registry if registry is nil.
+func Register[T any](registry *Registry, encode func(e *Encoder, v T) error, decode func(d *Decoder, v *T) error) {
+	var (
+		encodeFn EncodeFunc
+		decodeFn DecodeFunc
+	)
+	if registry == nil {
+		registry = defaultRegistry
+	}
+	if encode != nil {
+		encodeFn = func(e *Encoder, v interface{}) error {
+			return encode(e, v.(T))
+		}
+	}
+	if decode != nil {
+		decodeFn = func(d *Decoder, v interface{}) error {
+			return decode(d, v.(*T))
+		}
+	}
+	registry.Register(reflect.TypeOf((*T)(nil)).Elem(), encodeFn, decodeFn)
+}
@@ -0,0 +1,172 @@
+package bin
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type celsius float64
+
+func init() {
+	RegisterCodec(reflect.TypeOf(celsius(0)),
+		func(e *Encoder, v interface{}) error {
+			return e.WriteUint16(uint16(int16(v.(celsius) * 10)))
+		},
+		func(d *Decoder, v interface{}) error {
+			n, err := d.ReadUint16()
+			*v.(*celsius) = celsius(int16(n)) / 10
+			return err
+		})
+}
+
+func encodeHardwareAddr(e *Encoder, v net.HardwareAddr) error {
+	if len(v) > 255 {
+		return fmt.Errorf("Hardware address too long")
+	}
+	if err := e.WriteUint8(uint8(len(v))); err != nil {
+		return err
+	}
+	return e.WriteBytes(v)
+}
+
+func decodeHardwareAddr(d *Decoder, v *net.HardwareAddr) error {
+	n, err := d.ReadUint8()
+	if err == nil {
+		*v, err = d.ReadBytes(int(n))
+	}
+	return err
+}
+
+type hostname string
+
+func TestRegistryKinds(t *testing.T) {
+	type inTest struct {
+		Name hostname
+		Addr netip.Addr
+	}
+	var (
+		registry = new(Registry)
+		codec    = Codec{Registry: registry}
+		ins      = inTest{"lo", netip.MustParseAddr("127.0.0.1")}
+		except   = []byte{2, 'l', 'o', 127, 0, 0, 1}
+		outs     inTest
+	)
+	Register(registry, func(e *Encoder, v hostname) error {
+		if err := e.WriteUint8(uint8(len(v))); err != nil {
+			return err
+		}
+		return e.WriteBytes([]byte(v))
+	}, func(d *Decoder, v *hostname) error {
+		n, err := d.ReadUint8()
+		if err == nil {
+			var buf []byte
+			buf, err = d.ReadBytes(int(n))
+			*v = hostname(buf)
+		}
+		return err
+	})
+	Register(registry, func(e *Encoder, v netip.Addr) error {
+		return e.WriteBytes(v.AsSlice())
+	}, func(d *Decoder, v *netip.Addr) error {
+		buf, err := d.ReadBytes(4)
+		if err == nil {
+			*v = netip.AddrFrom4([4]byte(buf))
+		}
+		return err
+	})
+	if bs, e := codec.Marshal(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+	if e := codec.Unmarshal(except, &outs); e != nil || outs != ins {
+		t.Errorf("except %v, but got %v %v", ins, outs, e)
+	}
+
+	if _, e := MarshalBigEndian(ins); e == nil {
+		t.Errorf("except error but got nil")
+	}
+	if e := UnmarshalBigEndian(except, &outs); e == nil {
+		t.Errorf("except some error, but got nil")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	type inTest struct {
+		MAC     net.HardwareAddr
+		Timeout time.Duration
+		Temp    celsius
+		Peers   []net.HardwareAddr
+	}
+	var (
+		registry = new(Registry)
+		codec    = Codec{Registry: registry}
+		ins      = inTest{
+			MAC:     net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			Timeout: 3 * time.Second,
+			Temp:    -1.5,
+			Peers:   []net.HardwareAddr{{6, 7}},
+		}
+		except = []byte{6, 0, 1, 2, 3, 4, 5, 0, 0, 0x0b, 0xb8, 0xff, 0xf1, 2, 6, 7}
+	)
+	Register(registry, encodeHardwareAddr, decodeHardwareAddr)
+	Register(registry,
+		func(e *Encoder, v time.Duration) error {
+			return e.WriteUint32(uint32(v / time.Millisecond))
+		},
+		func(d *Decoder, v *time.Duration) error {
+			n, err := d.ReadUint32()
+			*v = time.Duration(n) * time.Millisecond
+			return err
+		})
+
+	if bs, e := codec.Marshal(ins); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, except) {
+		t.Errorf("except %v but got %v", except, bs)
+	}
+
+	var outs inTest
+	outs.Peers = make([]net.HardwareAddr, 1)
+	if e := codec.Unmarshal(except, &outs); e != nil {
+		t.Errorf("unexcept error: %v", e)
+	} else if !reflect.DeepEqual(ins, outs) {
+		t.Errorf("except %v, but got %v", ins, outs)
+	}
+
+	if bs, e := MarshalBigEndian(struct{ Temp *celsius }{new(celsius)}); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{0, 0}) {
+		t.Errorf("except %v but got %v", []byte{0, 0}, bs)
+	}
+
+	// the registry of a codec does not leak into others
+	if bs, e := MarshalBigEndian(time.Duration(1)); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{0, 0, 0, 0, 0, 0, 0, 1}) {
+		t.Errorf("except %v but got %v", []byte{0, 0, 0, 0, 0, 0, 0, 1}, bs)
+	}
+
+	// a registration only overrides its own direction
+	Register[time.Duration](registry, nil, nil)
+	if bs, e := codec.Marshal(time.Duration(1)); e != nil {
+		t.Errorf("got unexcepted error %v", e)
+	} else if !bytes.Equal(bs, []byte{0, 0, 0, 0, 0, 0, 0, 1}) {
+		t.Errorf("except %v but got %v", []byte{0, 0, 0, 0, 0, 0, 0, 1}, bs)
+	}
+	Register(registry, func(e *Encoder, v celsius) error {
+		return e.WriteUint8(uint8(v))
+	}, nil)
+	var temp celsius
+	if bs, e := codec.Marshal(celsius(20)); e != nil || !bytes.Equal(bs, []byte{20}) {
+		t.Errorf("except %v but got %v %v", []byte{20}, bs, e)
+	}
+	if e := codec.Unmarshal([]byte{0xff, 0xf1}, &temp); e != nil || temp != -1.5 {
+		t.Errorf("except -1.5 but got %v %v", temp, e)
+	}
+}
@@ -1,10 +1,67 @@
 package bin
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 )
 
+// OverflowError describes a value too long for the length prefix of its type.
+type OverflowError struct {
+	Type   string
+	Length uint64
+	Max    uint64
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("Length %d of %s overflows %d", e.Length, e.Type, e.Max)
+}
+
+// LengthError describes a declared length which disagrees with the length of the value.
+type LengthError struct {
+	Type   string
+	Length uint64
+	Actual uint64
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("Length %d of %s mismatches value length %d", e.Length, e.Type, e.Actual)
+}
+
+// prefixLength returns the length prefix of a value of size bytes.
+// A zero declared length is derived from size, others must agree with it.
+func prefixLength(name string, declared uint64, size int, max uint64) (uint64, error) {
+	switch {
+	case uint64(size) > max:
+		return 0, &OverflowError{name, uint64(size), max}
+	case declared != 0 && declared != uint64(size):
+		return 0, &LengthError{name, declared, uint64(size)}
+	}
+	return uint64(size), nil
+}
+
+// marshalStream returns the encoding of v by its EncodeBin method, for the endian-specific marshalers.
+func marshalStream(v StreamMarshaler, order binary.ByteOrder) ([]byte, error) {
+	var (
+		buffer = new(bytes.Buffer)
+		e      = &Encoder{codec: &Codec{Order: order}, writer: buffer}
+	)
+	e.setOrder(order)
+	if err := v.EncodeBin(e); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// unmarshalStream decodes v from data by its DecodeBin method, for the endian-specific unmarshalers.
+func unmarshalStream(v StreamUnmarshaler, data []byte, order binary.ByteOrder) (used int, err error) {
+	d := newDecoder(bytes.NewReader(data), &Codec{Order: order})
+	if err = v.DecodeBin(d); err != nil {
+		return 0, err
+	}
+	return int(d.read), nil
+}
+
 // Bytes8 defines a common byte slice type, which max length is 255.
 //
 //	+-----+-------+--------+   +--------+
@@ -12,33 +69,38 @@ import (
 // 	+-----+-------+--------+   +--------+
 type Bytes8 []byte
 
+// EncodeBin implements the StreamMarshaler interface.
+func (bs8 Bytes8) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("Bytes8", 0, bs8, 8)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (bs8 Bytes8) MarshalBigEndian() ([]byte, error) {
-	return append([]byte{byte(len(bs8))}, []byte(bs8)...), nil
+	return marshalStream(bs8, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (bs8 Bytes8) MarshalLittleEndian() ([]byte, error) {
-	return append([]byte{byte(len(bs8))}, []byte(bs8)...), nil
+	return marshalStream(bs8, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (bs8 *Bytes8) DecodeBin(d *Decoder) error {
+	_, value, err := d.readPrefixed(8)
+	if err == nil {
+		*bs8 = value
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (bs8 *Bytes8) UnmarshalBigEndian(data []byte) (used int, err error) {
-	size := len(data)
-	length := int(data[0])
-	if size < length+1 {
-		err = fmt.Errorf("Need more %d byte(s)", length+1-size)
-		return
-	}
-	*bs8 = make([]byte, length)
-	copy(*bs8, data[1:length+1])
-	used = length + 1
-	return
+	return unmarshalStream(bs8, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (bs8 *Bytes8) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	return bs8.UnmarshalBigEndian(data)
+	return unmarshalStream(bs8, data, binary.LittleEndian)
 }
 
 // String8 defines a common string type, which max length is 255.
@@ -48,35 +110,42 @@ func (bs8 *Bytes8) UnmarshalLittleEndian(data []byte) (used int, err error) {
 // 	+-----+-------+--------+   +--------+
 type String8 string
 
+// EncodeBin implements the StreamMarshaler interface.
+func (s8 String8) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("String8", 0, []byte(s8), 8)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (s8 String8) MarshalBigEndian() ([]byte, error) {
-	return append([]byte{byte(len(s8))}, []byte(s8)...), nil
+	return marshalStream(s8, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (s8 String8) MarshalLittleEndian() ([]byte, error) {
-	return append([]byte{byte(len(s8))}, []byte(s8)...), nil
+	return marshalStream(s8, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (s8 *String8) DecodeBin(d *Decoder) error {
+	_, value, err := d.readPrefixed(8)
+	if err == nil {
+		*s8 = String8(value)
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (s8 *String8) UnmarshalBigEndian(data []byte) (used int, err error) {
-	size := len(data)
-	length := int(data[0])
-	if size < length+1 {
-		err = fmt.Errorf("Need more %d byte(s)", length+1-size)
-		return
-	}
-	*s8 = String8(data[1 : length+1])
-	used = length + 1
-	return
+	return unmarshalStream(s8, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (s8 *String8) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	return s8.UnmarshalBigEndian(data)
+	return unmarshalStream(s8, data, binary.LittleEndian)
 }
 
 // Bytes16 defines a common byte slice type, the max length is math.MaxUint16.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |byte-0 | byte-1 |...| byte-n |
@@ -86,59 +155,48 @@ type Bytes16 struct {
 	Value  []byte
 }
 
+// Len returns the length of Value.
+func (bs16 Bytes16) Len() int {
+	return len(bs16.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (bs16 Bytes16) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("Bytes16", uint64(bs16.Length), bs16.Value, 16)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (bs16 Bytes16) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs16.Length))
-	binary.BigEndian.PutUint16(mem, bs16.Length)
-	return append(mem, bs16.Value...), nil
+	return marshalStream(bs16, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (bs16 Bytes16) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs16.Length))
-	binary.LittleEndian.PutUint16(mem, bs16.Length)
-	return append(mem, bs16.Value...), nil
+	return marshalStream(bs16, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (bs16 *Bytes16) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(16)
+	if err == nil {
+		bs16.Length = uint16(length)
+		bs16.Value = value
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (bs16 *Bytes16) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs16.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs16.Length = binary.BigEndian.Uint16(data[:size])
-	if uint16(length-size) < bs16.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs16.Length+uint16(size)-uint16(length))
-		return
-	}
-	bs16.Value = make([]byte, int(bs16.Length))
-	used = size + int(bs16.Length)
-	copy(bs16.Value, data[size:used])
-	return
+	return unmarshalStream(bs16, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (bs16 *Bytes16) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs16.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs16.Length = binary.LittleEndian.Uint16(data[:size])
-	if uint16(length-size) < bs16.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs16.Length+uint16(size)-uint16(length))
-		return
-	}
-	bs16.Value = make([]byte, int(bs16.Length))
-	used = size + int(bs16.Length)
-	copy(bs16.Value, data[size:used])
-	return
+	return unmarshalStream(bs16, data, binary.LittleEndian)
 }
 
 // Bytes32 defines a common byte slice type, the max length is math.MaxUint32.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |byte-0 | byte-1 |...| byte-n |
@@ -148,59 +206,48 @@ type Bytes32 struct {
 	Value  []byte
 }
 
+// Len returns the length of Value.
+func (bs32 Bytes32) Len() int {
+	return len(bs32.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (bs32 Bytes32) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("Bytes32", uint64(bs32.Length), bs32.Value, 32)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (bs32 Bytes32) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs32.Length))
-	binary.BigEndian.PutUint32(mem, bs32.Length)
-	return append(mem, bs32.Value...), nil
+	return marshalStream(bs32, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (bs32 Bytes32) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs32.Length))
-	binary.LittleEndian.PutUint32(mem, bs32.Length)
-	return append(mem, bs32.Value...), nil
+	return marshalStream(bs32, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (bs32 *Bytes32) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(32)
+	if err == nil {
+		bs32.Length = uint32(length)
+		bs32.Value = value
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (bs32 *Bytes32) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs32.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs32.Length = binary.BigEndian.Uint32(data[:size])
-	if uint32(length-size) < bs32.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs32.Length+uint32(size)-uint32(length))
-		return
-	}
-	bs32.Value = make([]byte, int(bs32.Length))
-	used = size + int(bs32.Length)
-	copy(bs32.Value, data[size:used])
-	return
+	return unmarshalStream(bs32, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (bs32 *Bytes32) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs32.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs32.Length = binary.LittleEndian.Uint32(data[:size])
-	if uint32(length-size) < bs32.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs32.Length+uint32(size)-uint32(length))
-		return
-	}
-	bs32.Value = make([]byte, int(bs32.Length))
-	used = size + int(bs32.Length)
-	copy(bs32.Value, data[size:used])
-	return
+	return unmarshalStream(bs32, data, binary.LittleEndian)
 }
 
 // Bytes64 defines a common byte slice type, the max length is math.MaxUint64.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |byte-0 | byte-1 |...| byte-n |
@@ -210,59 +257,48 @@ type Bytes64 struct {
 	Value  []byte
 }
 
+// Len returns the length of Value.
+func (bs64 Bytes64) Len() int {
+	return len(bs64.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (bs64 Bytes64) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("Bytes64", uint64(bs64.Length), bs64.Value, 64)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (bs64 Bytes64) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs64.Length))
-	binary.BigEndian.PutUint64(mem, bs64.Length)
-	return append(mem, bs64.Value...), nil
+	return marshalStream(bs64, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (bs64 Bytes64) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(bs64.Length))
-	binary.LittleEndian.PutUint64(mem, bs64.Length)
-	return append(mem, bs64.Value...), nil
+	return marshalStream(bs64, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (bs64 *Bytes64) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(64)
+	if err == nil {
+		bs64.Length = uint64(length)
+		bs64.Value = value
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (bs64 *Bytes64) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs64.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs64.Length = binary.BigEndian.Uint64(data[:size])
-	if uint64(length-size) < bs64.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs64.Length+uint64(size)-uint64(length))
-		return
-	}
-	bs64.Value = make([]byte, int(bs64.Length))
-	used = size + int(bs64.Length)
-	copy(bs64.Value, data[size:used])
-	return
+	return unmarshalStream(bs64, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (bs64 *Bytes64) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(bs64.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	bs64.Length = binary.LittleEndian.Uint64(data[:size])
-	if uint64(length-size) < bs64.Length {
-		err = fmt.Errorf("Need more %d byte(s)", bs64.Length+uint64(size)-uint64(length))
-		return
-	}
-	bs64.Value = make([]byte, int(bs64.Length))
-	used = size + int(bs64.Length)
-	copy(bs64.Value, data[size:used])
-	return
+	return unmarshalStream(bs64, data, binary.LittleEndian)
 }
 
 // String16 defines a common string type, which max length is math.MaxUint16.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |char-0 | char-1 |...| char-n |
@@ -272,57 +308,48 @@ type String16 struct {
 	Value  string
 }
 
+// Len returns the length of Value.
+func (s16 String16) Len() int {
+	return len(s16.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (s16 String16) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("String16", uint64(s16.Length), []byte(s16.Value), 16)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (s16 String16) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s16.Length))
-	binary.BigEndian.PutUint16(mem, s16.Length)
-	return append(mem, []byte(s16.Value)...), nil
+	return marshalStream(s16, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (s16 String16) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s16.Length))
-	binary.LittleEndian.PutUint16(mem, s16.Length)
-	return append(mem, []byte(s16.Value)...), nil
+	return marshalStream(s16, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (s16 *String16) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(16)
+	if err == nil {
+		s16.Length = uint16(length)
+		s16.Value = string(value)
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (s16 *String16) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s16.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s16.Length = binary.BigEndian.Uint16(data[:size])
-	if uint16(length-size) < s16.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s16.Length+uint16(size)-uint16(length))
-		return
-	}
-	used = size + int(s16.Length)
-	s16.Value = string(data[size:used])
-	return
+	return unmarshalStream(s16, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (s16 *String16) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s16.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s16.Length = binary.LittleEndian.Uint16(data[:size])
-	if uint16(length-size) < s16.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s16.Length+uint16(size)-uint16(length))
-		return
-	}
-	used = size + int(s16.Length)
-	s16.Value = string(data[size:used])
-	return
+	return unmarshalStream(s16, data, binary.LittleEndian)
 }
 
 // String32 defines a common string type, which max length is math.MaxUint32.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |char-0 | char-1 |...| char-n |
@@ -332,57 +359,48 @@ type String32 struct {
 	Value  string
 }
 
+// Len returns the length of Value.
+func (s32 String32) Len() int {
+	return len(s32.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (s32 String32) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("String32", uint64(s32.Length), []byte(s32.Value), 32)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (s32 String32) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s32.Length))
-	binary.BigEndian.PutUint32(mem, s32.Length)
-	return append(mem, []byte(s32.Value)...), nil
+	return marshalStream(s32, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (s32 String32) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s32.Length))
-	binary.LittleEndian.PutUint32(mem, s32.Length)
-	return append(mem, []byte(s32.Value)...), nil
+	return marshalStream(s32, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (s32 *String32) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(32)
+	if err == nil {
+		s32.Length = uint32(length)
+		s32.Value = string(value)
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (s32 *String32) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s32.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s32.Length = binary.BigEndian.Uint32(data[:size])
-	if uint32(length-size) < s32.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s32.Length+uint32(size)-uint32(length))
-		return
-	}
-	used = size + int(s32.Length)
-	s32.Value = string(data[size:used])
-	return
+	return unmarshalStream(s32, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (s32 *String32) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s32.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s32.Length = binary.LittleEndian.Uint32(data[:size])
-	if uint32(length-size) < s32.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s32.Length+uint32(size)-uint32(length))
-		return
-	}
-	used = size + int(s32.Length)
-	s32.Value = string(data[size:used])
-	return
+	return unmarshalStream(s32, data, binary.LittleEndian)
 }
 
 // String64 defines a common string type, which max length is math.MaxUint64.
+// A zero Length is derived from Value while marshaling, any other Length must agree with it.
 //
 // +--....--+-------+--------+   +--------+
 // | length |char-0 | char-1 |...| char-n |
@@ -392,52 +410,42 @@ type String64 struct {
 	Value  string
 }
 
+// Len returns the length of Value.
+func (s64 String64) Len() int {
+	return len(s64.Value)
+}
+
+// EncodeBin implements the StreamMarshaler interface.
+func (s64 String64) EncodeBin(e *Encoder) error {
+	return e.writePrefixed("String64", uint64(s64.Length), []byte(s64.Value), 64)
+}
+
 // MarshalBigEndian implements the BigEndianMarshaler interface.
 func (s64 String64) MarshalBigEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s64.Length))
-	binary.BigEndian.PutUint64(mem, s64.Length)
-	return append(mem, []byte(s64.Value)...), nil
+	return marshalStream(s64, binary.BigEndian)
 }
 
 // MarshalLittleEndian implements the LittleEndianMarshaler interface.
 func (s64 String64) MarshalLittleEndian() ([]byte, error) {
-	var mem []byte = make([]byte, binary.Size(s64.Length))
-	binary.LittleEndian.PutUint64(mem, s64.Length)
-	return append(mem, []byte(s64.Value)...), nil
+	return marshalStream(s64, binary.LittleEndian)
+}
+
+// DecodeBin implements the StreamUnmarshaler interface.
+func (s64 *String64) DecodeBin(d *Decoder) error {
+	length, value, err := d.readPrefixed(64)
+	if err == nil {
+		s64.Length = uint64(length)
+		s64.Value = string(value)
+	}
+	return err
 }
 
 // UnmarshalBigEndian implements the BigEndianUnmarshaler interface.
 func (s64 *String64) UnmarshalBigEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s64.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s64.Length = binary.BigEndian.Uint64(data[:size])
-	if uint64(length-size) < s64.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s64.Length+uint64(size)-uint64(length))
-		return
-	}
-	used = size + int(s64.Length)
-	s64.Value = string(data[size:used])
-	return
+	return unmarshalStream(s64, data, binary.BigEndian)
 }
 
 // UnmarshalLittleEndian implements the LittleEndianUnmarshaler interface.
 func (s64 *String64) UnmarshalLittleEndian(data []byte) (used int, err error) {
-	var size int = binary.Size(s64.Length)
-	var length int = len(data)
-	if length < size {
-		err = fmt.Errorf("Need more %d byte(s)", size-length)
-		return
-	}
-	s64.Length = binary.LittleEndian.Uint64(data[:size])
-	if uint64(length-size) < s64.Length {
-		err = fmt.Errorf("Need more %d byte(s)", s64.Length+uint64(size)-uint64(length))
-		return
-	}
-	used = size + int(s64.Length)
-	s64.Value = string(data[size:used])
-	return
+	return unmarshalStream(s64, data, binary.LittleEndian)
 }
@@ -2,6 +2,9 @@ package bin
 
 import (
 	"bytes"
+	"errors"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -504,3 +507,151 @@ func TestString64UnmarshalError(t *testing.T) {
 		}
 	}
 }
+
+func TestTypesMarshalLength(t *testing.T) {
+	for i, caze := range []struct {
+		ins    interface{}
+		except []byte
+	}{
+		{Bytes16{Value: []byte{117, 117}}, []byte{0, 2, 117, 117}},
+		{Bytes32{Value: []byte{117}}, []byte{0, 0, 0, 1, 117}},
+		{Bytes64{}, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{String16{Value: "uu"}, []byte{0, 2, 117, 117}},
+		{String32{Length: 1, Value: "u"}, []byte{0, 0, 0, 1, 117}},
+		{String64{Value: "u"}, []byte{0, 0, 0, 0, 0, 0, 0, 1, 117}},
+	} {
+		if bs, err := MarshalBigEndian(caze.ins); err != nil {
+			t.Errorf("case %d got unexcept error: %v", i, err)
+		} else if !bytes.Equal(bs, caze.except) {
+			t.Errorf("case %d except %v, but got %v", i, caze.except, bs)
+		}
+	}
+}
+
+func TestTypesMarshalLengthError(t *testing.T) {
+	long := make([]byte, math.MaxUint16+1)
+	for i, caze := range []struct {
+		ins      interface{}
+		overflow bool
+	}{
+		{Bytes8(long[:256]), true},
+		{String8(long[:256]), true},
+		{Bytes16{Value: long}, true},
+		{String16{Value: string(long)}, true},
+		{Bytes16{Length: 3, Value: []byte{117}}, false},
+		{Bytes32{Length: 3, Value: []byte{117}}, false},
+		{Bytes64{Length: 3}, false},
+		{String16{Length: 1, Value: "uu"}, false},
+		{String32{Length: 1}, false},
+		{String64{Length: 1, Value: "uu"}, false},
+	} {
+		_, big := MarshalBigEndian(caze.ins)
+		_, little := MarshalLittleEndian(caze.ins)
+		for _, err := range []error{big, little} {
+			var (
+				overflow *OverflowError
+				mismatch *LengthError
+			)
+			if caze.overflow && !errors.As(err, &overflow) {
+				t.Errorf("case %d except OverflowError, but got %v", i, err)
+			} else if !caze.overflow && !errors.As(err, &mismatch) {
+				t.Errorf("case %d except LengthError, but got %v", i, err)
+			}
+		}
+	}
+}
+
+// fuzzType checks that decoding arbitrary data into the value returned by
+// newIns never panics, and that a successful decoding marshals back to the
+// bytes it used.
+func fuzzType(f *testing.F, newIns func() interface{}) {
+	for _, seed := range [][]byte{
+		{},
+		{0},
+		{3, 97, 98, 99},
+		{0, 2, 117, 117},
+		{0, 0, 0, 2, 117, 117},
+		{0, 0, 0, 0, 0, 0, 0, 2, 117, 117},
+		{255, 255, 255, 255, 255, 255, 255, 255, 255},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		big, little := newIns(), newIns()
+		if used, err := big.(BigEndianUnmarshaler).UnmarshalBigEndian(data); err == nil {
+			if used < 0 || used > len(data) {
+				t.Fatalf("used %d out of %d byte(s)", used, len(data))
+			}
+			if bs, err := MarshalBigEndian(reflect.ValueOf(big).Elem().Interface()); err != nil {
+				t.Errorf("unexcept error: %v", err)
+			} else if !bytes.Equal(bs, data[:used]) {
+				t.Errorf("except %v, but got %v", data[:used], bs)
+			}
+		}
+		if used, err := little.(LittleEndianUnmarshaler).UnmarshalLittleEndian(data); err == nil {
+			if used < 0 || used > len(data) {
+				t.Fatalf("used %d out of %d byte(s)", used, len(data))
+			}
+			if bs, err := MarshalLittleEndian(reflect.ValueOf(little).Elem().Interface()); err != nil {
+				t.Errorf("unexcept error: %v", err)
+			} else if !bytes.Equal(bs, data[:used]) {
+				t.Errorf("except %v, but got %v", data[:used], bs)
+			}
+		}
+		UnmarshalBigEndian(data, newIns())
+		UnmarshalLittleEndian(data, newIns())
+	})
+}
+
+func FuzzBytes8(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(Bytes8) })
+}
+
+func FuzzString8(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(String8) })
+}
+
+func FuzzBytes16(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(Bytes16) })
+}
+
+func FuzzBytes32(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(Bytes32) })
+}
+
+func FuzzBytes64(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(Bytes64) })
+}
+
+func FuzzString16(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(String16) })
+}
+
+func FuzzString32(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(String32) })
+}
+
+func FuzzString64(f *testing.F) {
+	fuzzType(f, func() interface{} { return new(String64) })
+}
+
+func TestTypesEndianMethods(t *testing.T) {
+	if bs, err := (Bytes16{Value: []byte("ok")}).MarshalLittleEndian(); err != nil || !bytes.Equal(bs, []byte{2, 0, 'o', 'k'}) {
+		t.Errorf("except %v, but got %v %v", []byte{2, 0, 'o', 'k'}, bs, err)
+	}
+	if _, err := (Bytes16{Length: 3, Value: []byte("ok")}).MarshalBigEndian(); err == nil {
+		t.Errorf("except some error but got nil")
+	}
+
+	var bs16 Bytes16
+	if used, err := bs16.UnmarshalLittleEndian([]byte{2, 0, 'o', 'k', 9}); err != nil || used != 4 {
+		t.Errorf("except 4 byte(s) used, but got %d %v", used, err)
+	} else if !reflect.DeepEqual(bs16, Bytes16{2, []byte("ok")}) {
+		t.Errorf("except %v, but got %v", Bytes16{2, []byte("ok")}, bs16)
+	}
+
+	var s8 String8
+	if used, err := s8.UnmarshalBigEndian([]byte{3, 'a'}); err == nil || used != 0 {
+		t.Errorf("except some error, but got %d %v", used, err)
+	}
+}
@@ -0,0 +1,85 @@
+package bin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Validator is the interface implemented by types that can check their own validity.
+// Validate is called on a value after it is unmarshaled, inner values first, and before it is marshaled.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf(new(Validator)).Elem()
+
+// ValidationError describes a value whose Validate method failed.
+type ValidationError struct {
+	// Path is the dotted path of struct fields leading to the value, empty for the top-level value.
+	Path string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("Invalid value: %v", e.Err)
+	}
+	return fmt.Sprintf("Field %s: %v", e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// fieldPath is a node of the path of struct fields leading to a value.
+type fieldPath struct {
+	parent *fieldPath
+	name   string
+}
+
+// extend returns the path of the values nested in the value of top.
+func (top *frame) extend() *fieldPath {
+	if top.field == nil || top.field.name == "" {
+		return top.path
+	}
+	return &fieldPath{top.path, top.field.name}
+}
+
+// pathString returns the dotted path of struct fields leading to the value of top.
+func (top *frame) pathString() string {
+	var names []string
+	if top.field != nil && top.field.name != "" {
+		names = append(names, top.field.name)
+	}
+	for p := top.path; p != nil; p = p.parent {
+		names = append(names, p.name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, ".")
+}
+
+// hasValidator reports whether a value of type tpe is validated, pointers are validated through their elements.
+func hasValidator(tpe reflect.Type) bool {
+	return tpe.Kind() != reflect.Ptr && tpe.Kind() != reflect.Interface &&
+		(tpe.Implements(validatorType) || reflect.PtrTo(tpe).Implements(validatorType))
+}
+
+// validate calls the Validate method of the value of top.
+func validate(top frame) error {
+	cur := top.value
+	if !cur.Type().Implements(validatorType) {
+		if !cur.CanAddr() {
+			addressable := reflect.New(cur.Type()).Elem()
+			addressable.Set(cur)
+			cur = addressable
+		}
+		cur = cur.Addr()
+	}
+	if err := cur.Interface().(Validator).Validate(); err != nil {
+		return &ValidationError{top.pathString(), err}
+	}
+	return nil
+}
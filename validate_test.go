@@ -0,0 +1,80 @@
+package bin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errZeroPort = errors.New("zero port")
+
+type port uint16
+
+func (p port) Validate() error {
+	if p == 0 {
+		return errZeroPort
+	}
+	return nil
+}
+
+type endpoint struct {
+	IP   [4]byte
+	Port port
+}
+
+type request struct {
+	Ver     byte
+	Targets []endpoint
+	Proxy   *endpoint
+}
+
+func (req *request) Validate() error {
+	if req.Ver != 5 {
+		return fmt.Errorf("unsupported version %d", req.Ver)
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	for i, caze := range []struct {
+		data []byte
+		path string
+		err  error
+	}{
+		{[]byte{5, 127, 0, 0, 1, 0, 80, 10, 0, 0, 1, 4, 56}, "", nil},
+		{[]byte{5, 127, 0, 0, 1, 0, 0, 10, 0, 0, 1, 4, 56}, "Targets.Port", errZeroPort},
+		{[]byte{5, 127, 0, 0, 1, 0, 80, 10, 0, 0, 1, 0, 0}, "Proxy.Port", errZeroPort},
+		{[]byte{4, 127, 0, 0, 1, 0, 80, 10, 0, 0, 1, 4, 56}, "", nil},
+	} {
+		var (
+			outs  = request{Targets: make([]endpoint, 1)}
+			ve    *ValidationError
+			e     = UnmarshalBigEndian(caze.data, &outs)
+			valid = caze.data[0] == 5 && caze.err == nil
+		)
+		switch {
+		case valid && e != nil:
+			t.Errorf("case %d unexcept error: %v", i, e)
+		case !valid && !errors.As(e, &ve):
+			t.Errorf("case %d except ValidationError, but got %v", i, e)
+		case !valid && (ve.Path != caze.path || (caze.err != nil && !errors.Is(e, caze.err))):
+			t.Errorf("case %d except %s %v, but got %v", i, caze.path, caze.err, e)
+		}
+
+		_, e = MarshalBigEndian(outs)
+		switch {
+		case valid && e != nil:
+			t.Errorf("case %d got unexcepted error %v", i, e)
+		case !valid && !errors.As(e, &ve):
+			t.Errorf("case %d except ValidationError, but got %v", i, e)
+		}
+	}
+
+	var ve *ValidationError
+	if _, e := MarshalBigEndian(map[port]port{1: 0}); !errors.As(e, &ve) || ve.Path != "" || ve.Error() != "Invalid value: zero port" {
+		t.Errorf("except ValidationError, but got %v", e)
+	}
+	if e := UnmarshalBigEndian([]byte{0, 0, 0, 1, 0, 1, 0, 0}, &struct{ Ports map[port]port }{}); !errors.As(e, &ve) || ve.Error() != "Field Ports: zero port" {
+		t.Errorf("except ValidationError, but got %v", e)
+	}
+}